@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"time"
@@ -19,6 +20,7 @@ import (
 func main() {
 	r := gin.Default()
 	r.GET("/api/scan/:message", scanHandler)
+	r.POST("/api/scan/:message", scanHandler)
 	if err := r.Run(":8080"); err != nil {
 		log.Fatalf("Failed to run Gin server: %v", err)
 	}
@@ -45,9 +47,20 @@ func scanHandler(c *gin.Context) {
 		return
 	}
 
+	// POST bodies carry the request parameters, e.g. for setSchedule
+	payload := []byte("request")
+	if c.Request.Method == http.MethodPost {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body", "details": err.Error()})
+			return
+		}
+		payload = body
+	}
+
 	// Send request message
 	if err := stream.Send(&rpcEngine.Message{
-		Message:     []byte("request"),
+		Message:     payload,
 		MessageType: messageType,
 	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message", "details": err.Error()})
@@ -75,9 +88,23 @@ func scanHandler(c *gin.Context) {
 			}
 			for _, proc := range processes {
 				results = append(results, gin.H{
-					"PID":     proc.PID,
-					"Name":    proc.Name,
-					"ExePath": proc.ExePath,
+					"PID":            proc.PID,
+					"Name":           proc.Name,
+					"ExePath":        proc.ExePath,
+					"Indicator":      proc.Indicator,
+					"GUID":           proc.GUID,
+					"PPID":           proc.PPID,
+					"Cmdline":        proc.Cmdline,
+					"User":           proc.User,
+					"UID":            proc.UID,
+					"StartTime":      proc.StartTime,
+					"Cwd":            proc.Cwd,
+					"IntegrityLevel": proc.IntegrityLevel,
+					"Signer":         proc.Signer,
+					"MD5":            proc.MD5,
+					"SHA256":         proc.SHA256,
+					"Size":           proc.Size,
+					"ModTime":        proc.ModTime,
 				})
 			}
 
@@ -92,11 +119,33 @@ func scanHandler(c *gin.Context) {
 					"ParentPID":  r.ParentPID,
 					"ChildName":  r.ChildName,
 					"ChildPID":   r.ChildPID,
+					"Depth":      r.Depth,
+					"Rule":       r.Rule.ID,
+					"RuleName":   r.Rule.Name,
+					"Severity":   r.Rule.Severity,
+					"Tags":       r.Rule.Tags,
+				})
+			}
+
+		case "pathIndicatorResults":
+			var matches []PathMatchInfo
+			if err := json.Unmarshal(resp.Message, &matches); err != nil {
+				continue
+			}
+			for _, m := range matches {
+				results = append(results, gin.H{
+					"Path":    m.Path,
+					"Pattern": m.Pattern,
+					"Type":    m.Type,
 				})
 			}
 
 		default:
 			// Fallback for any other message type
+			if json.Valid(resp.Message) {
+				results = append(results, json.RawMessage(resp.Message))
+				continue
+			}
 			results = append(results, gin.H{
 				"RawMessage": string(resp.Message),
 			})
@@ -3,20 +3,49 @@ package main
 import (
 	"crypto/x509"
 	"sync"
+	"time"
 )
 
 type ProcessInfo struct {
-	PID     int32   `json:"pid"`
-	Name    string  `json:"name"`
-	ExePath string  `json:"exePath"`
-	Signer  *string `json:"signer,omitempty"`
+	PID            int32     `json:"pid"`
+	Name           string    `json:"name"`
+	ExePath        string    `json:"exePath"`
+	Signer         *string   `json:"signer,omitempty"`
+	Indicator      string    `json:"indicator,omitempty"`
+	GUID           string    `json:"guid"`
+	PPID           int32     `json:"ppid"`
+	Cmdline        string    `json:"cmdline,omitempty"`
+	User           string    `json:"user,omitempty"`
+	UID            string    `json:"uid,omitempty"`
+	StartTime      time.Time `json:"startTime"`
+	Cwd            string    `json:"cwd,omitempty"`
+	IntegrityLevel string    `json:"integrityLevel,omitempty"`
+	MD5            string    `json:"md5,omitempty"`
+	SHA256         string    `json:"sha256,omitempty"`
+	Size           int64     `json:"size"`
+	ModTime        time.Time `json:"modTime"`
 }
 
 type RelationshipInfo struct {
-	ParentPID  int32  `json:"parentPid"`
-	ParentName string `json:"parentName"`
-	ChildPID   int32  `json:"childPid"`
-	ChildName  string `json:"childName"`
+	ParentPID  int32            `json:"parentPid"`
+	ParentName string           `json:"parentName"`
+	ChildPID   int32            `json:"childPid"`
+	ChildName  string           `json:"childName"`
+	Depth      int              `json:"depth"`
+	Rule       RelationshipRule `json:"rule"`
+}
+
+type RelationshipRule struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Severity string   `json:"severity"`
+	Tags     []string `json:"tags"`
+}
+
+type PathMatchInfo struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
 }
 
 type MonitorConfig struct {
@@ -1,46 +1,12 @@
 package main
 
 import (
-	"os"
-	"strings"
-	"syscall"
-	"time"
-
 	"github.com/bhaiFi/security-monitor/internal/agentEngine"
 	"github.com/bhaiFi/security-monitor/internal/logger"
-	"golang.org/x/sys/windows"
 
 	"github.com/kardianos/service"
 )
 
-func CheckAdmin() bool {
-
-	_, err := os.Open("\\\\.\\PHYSICALDRIVE0")
-	return err == nil
-}
-
-func RunElevated() {
-
-	verb := "runas"
-	exe, _ := os.Executable()
-	cwd, _ := os.Getwd()
-	args := strings.Join(os.Args[1:], " ")
-
-	verbPtr, _ := syscall.UTF16PtrFromString(verb)
-	exePtr, _ := syscall.UTF16PtrFromString(exe)
-	cwdPtr, _ := syscall.UTF16PtrFromString(cwd)
-	argsPtr, _ := syscall.UTF16PtrFromString(args)
-
-	var showCmd int32 = 1
-
-	err := windows.ShellExecute(0, verbPtr, exePtr, argsPtr, cwdPtr, showCmd)
-	if err != nil {
-		time.Sleep(2 * time.Second)
-	}
-
-	os.Exit(0)
-}
-
 // Define the service configuration.
 func configureService() *service.Config {
 
@@ -48,10 +14,7 @@ func configureService() *service.Config {
 		Name:        "bhaifiAgent",
 		DisplayName: "BhaiFi Agent",
 		Description: "BhaiFi Agent",
-		Option: service.KeyValue{
-			service.StartType: service.ServiceStartAutomatic,
-			service.OnFailure: service.OnFailureRestart,
-		},
+		Option:      serviceOptions(),
 	}
 }
 
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kardianos/service"
+)
+
+// serviceOptions restarts the agent on failure, as the Windows service does.
+func serviceOptions() service.KeyValue {
+
+	return service.KeyValue{
+		"Restart": "always",
+	}
+}
+
+func CheckAdmin() bool {
+
+	return os.Geteuid() == 0
+}
+
+// RunElevated cannot prompt for elevation outside Windows, so the agent asks
+// to be started as root instead.
+func RunElevated() {
+
+	fmt.Fprintln(os.Stderr, "BhaiFi Agent must be run as root")
+	os.Exit(1)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kardianos/service"
+	"golang.org/x/sys/windows"
+)
+
+func serviceOptions() service.KeyValue {
+
+	return service.KeyValue{
+		service.StartType: service.ServiceStartAutomatic,
+		service.OnFailure: service.OnFailureRestart,
+	}
+}
+
+func CheckAdmin() bool {
+
+	_, err := os.Open("\\\\.\\PHYSICALDRIVE0")
+	return err == nil
+}
+
+func RunElevated() {
+
+	verb := "runas"
+	exe, _ := os.Executable()
+	cwd, _ := os.Getwd()
+	args := strings.Join(os.Args[1:], " ")
+
+	verbPtr, _ := syscall.UTF16PtrFromString(verb)
+	exePtr, _ := syscall.UTF16PtrFromString(exe)
+	cwdPtr, _ := syscall.UTF16PtrFromString(cwd)
+	argsPtr, _ := syscall.UTF16PtrFromString(args)
+
+	var showCmd int32 = 1
+
+	err := windows.ShellExecute(0, verbPtr, exePtr, argsPtr, cwdPtr, showCmd)
+	if err != nil {
+		time.Sleep(2 * time.Second)
+	}
+
+	os.Exit(0)
+}
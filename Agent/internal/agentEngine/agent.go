@@ -11,7 +11,9 @@ import (
 	"github.com/bhaiFi/security-monitor/internal/agentScanner"
 	"github.com/bhaiFi/security-monitor/internal/config"
 	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/rules"
 	"github.com/bhaiFi/security-monitor/internal/scannerEngine"
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
 	"github.com/bhaiFi/security-monitor/internal/signature"
 	"github.com/bhaiFi/security-monitor/internal/threatintel"
 	"github.com/bhaiFi/security-monitor/pkg/rpcEngine"
@@ -53,12 +55,64 @@ func (agentEngine *AgentEngine) Start() {
 	}
 	logger.LogInfo(logPrefix, "Signature verifier initialized", "", nil)
 
-	scanner := agentScanner.NewScanner(cfg.Monitor, ti, sv)
+	rulesPath := resolvePath(filePath, cfg.Monitor.RelationshipRules)
+	relRules, err := rules.LoadRelationshipRules(rulesPath)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to load relationship rules, using the defaults", rulesPath, err)
+		relRules = rules.NewRelationshipEngine(rules.DefaultRelationshipRules)
+	}
+	logger.LogInfo(logPrefix, "Relationship rules loaded", "", relRules.Len())
+
+	if cfg.Monitor.Persistence != nil {
+		cfg.Monitor.Persistence.BaselinePath = resolvePath(filePath, cfg.Monitor.Persistence.BaselinePath)
+	}
+	if cfg.Monitor.Learning != nil {
+		cfg.Monitor.Learning.Path = resolvePath(filePath, cfg.Monitor.Learning.Path)
+	}
+
+	scanner := agentScanner.NewScanner(cfg.Monitor, ti, sv, relRules)
 	logger.LogInfo(logPrefix, "Scanner initialized", "", nil)
 
+	if masq := cfg.Monitor.Masquerade; masq != nil && masq.Enabled {
+		tablePath := resolvePath(filePath, masq.Table)
+		checker, err := rules.LoadMasqueradeTable(tablePath, masq.MaxEditDistance)
+		if err != nil {
+			logger.LogError(logPrefix, "Failed to load masquerade table, using the default", tablePath, err)
+			checker = rules.NewMasqueradeChecker(rules.DefaultMasqueradeTable, masq.MaxEditDistance)
+		}
+		scanner.SetMasqueradeChecker(checker)
+		logger.LogInfo(logPrefix, "Masquerade table loaded", "", checker.Len())
+	}
+
+	var store *scanstore.Store
+	if hs := cfg.Monitor.HistoryStore; hs != nil && hs.Enabled {
+		hs.Path = resolvePath(filePath, hs.Path)
+		if store, err = scanstore.Open(hs); err != nil {
+			logger.LogError(logPrefix, "Failed to open history store, history will not be kept", hs.Path, err)
+		} else {
+			scanner.SetHistoryStore(store)
+			logger.LogInfo(logPrefix, "History store opened", hs.Path, nil)
+		}
+	}
+
+	procSource, err := agentScanner.NewProcessSource(cfg.Monitor.ProcessSource, filePath)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to initialize process source", "", err)
+		log.Fatalf("Failed to initialize process source: %v", err)
+	}
+	scanner.SetProcessSource(procSource)
+	logger.LogInfo(logPrefix, "Process source initialized", procSource.Name(), nil)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	agentEngine.cancelFunc = cancel
 
+	if store != nil {
+		store.Start(ctx)
+	}
+
+	ti.StartWatching(ctx)
+	logger.LogInfo(logPrefix, "Started threat feed watcher", "", nil)
+
 	scanner.StartBackground(ctx)
 	logger.LogInfo(logPrefix, "Started background scanner", "", nil)
 
@@ -80,6 +134,14 @@ func (agentEngine *AgentEngine) Start() {
 	}
 }
 
+// resolvePath makes a path from the config file relative to the agent's directory.
+func resolvePath(directory, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(directory, path)
+}
+
 func (agentEngine *AgentEngine) Stop() {
 	logPrefix := "AgentEngine.Stop"
 
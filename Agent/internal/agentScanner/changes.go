@@ -0,0 +1,223 @@
+package agentScanner
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// Change event types, also published to subscribers.
+const (
+	EventAppeared    = "appeared"
+	EventDisappeared = "disappeared"
+)
+
+// Kinds of items tracked from scan to scan.
+const (
+	ChangeProcess      = "process"
+	ChangeUnsigned     = "unsignedProcess"
+	ChangeMalicious    = "maliciousProcess"
+	ChangeRelationship = "relationship"
+	ChangeMasquerade   = "masquerade"
+	ChangeModule       = "moduleFinding"
+	ChangeImage        = "imageFinding"
+	ChangeFile         = "fileFinding"
+	ChangeListener     = "listener"
+	ChangePersistence  = "persistence"
+)
+
+// Change is an item that appeared in or disappeared from a scan compared to
+// the previous scan of the same kind. Cursor increases with every change.
+type Change struct {
+	Cursor uint64      `json:"cursor"`
+	Type   string      `json:"type"`
+	Kind   string      `json:"kind"`
+	Key    string      `json:"key"`
+	Time   time.Time   `json:"time"`
+	Data   interface{} `json:"data"`
+}
+
+// ChangeSet answers changesSince. Cursor is the value to pass on the next
+// poll. Truncated is set when changes after the requested cursor were
+// already dropped, in which case the full results must be fetched again.
+type ChangeSet struct {
+	Cursor    uint64   `json:"cursor"`
+	Truncated bool     `json:"truncated"`
+	Changes   []Change `json:"changes"`
+}
+
+// changeTracker diffs each scan against the previous one and keeps the most
+// recent changes. The first scan of a kind only records the baseline.
+type changeTracker struct {
+	previous map[string]map[string]interface{}
+	changes  []Change
+	size     int
+	cursor   uint64
+	mu       sync.Mutex
+}
+
+func newChangeTracker(size int) *changeTracker {
+	if size <= 0 {
+		size = models.DefaultChangeBufferSize
+	}
+	return &changeTracker{previous: make(map[string]map[string]interface{}), size: size}
+}
+
+// update replaces the snapshot of a kind and returns what changed.
+func (t *changeTracker) update(kind string, current map[string]interface{}, now time.Time) []Change {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, seen := t.previous[kind]
+	t.previous[kind] = current
+	if !seen {
+		logger.LogInfo("agentScanner.changeTracker", fmt.Sprintf("Recorded baseline of %d items", len(current)), kind, nil)
+		return nil
+	}
+
+	var changes []Change
+	for key, data := range current {
+		if _, ok := previous[key]; !ok {
+			changes = append(changes, t.record(EventAppeared, kind, key, data, now))
+		}
+	}
+	for key, data := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, t.record(EventDisappeared, kind, key, data, now))
+		}
+	}
+	return changes
+}
+
+// add records a single item seen between scans, such as a file reported by
+// the real-time watcher. It returns false if the item was already known.
+func (t *changeTracker) add(kind, key string, data interface{}, now time.Time) (Change, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot, seen := t.previous[kind]
+	if !seen {
+		snapshot = make(map[string]interface{})
+		t.previous[kind] = snapshot
+	}
+	_, known := snapshot[key]
+	snapshot[key] = data
+	if known {
+		return Change{}, false
+	}
+	return t.record(EventAppeared, kind, key, data, now), true
+}
+
+// record appends a change, dropping the oldest once the buffer is full.
+// Callers hold mu.
+func (t *changeTracker) record(eventType, kind, key string, data interface{}, now time.Time) Change {
+	t.cursor++
+	change := Change{Cursor: t.cursor, Type: eventType, Kind: kind, Key: key, Time: now, Data: data}
+	if len(t.changes) >= t.size {
+		t.changes = t.changes[len(t.changes)-t.size+1:]
+	}
+	t.changes = append(t.changes, change)
+	return change
+}
+
+// since returns the changes recorded after cursor, oldest first.
+func (t *changeTracker) since(cursor uint64) ChangeSet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	set := ChangeSet{Cursor: t.cursor, Changes: []Change{}}
+	if cursor >= t.cursor {
+		return set
+	}
+	if len(t.changes) == 0 || t.changes[0].Cursor > cursor+1 {
+		set.Truncated = true
+	}
+	for _, change := range t.changes {
+		if change.Cursor > cursor {
+			set.Changes = append(set.Changes, change)
+		}
+	}
+	return set
+}
+
+// keyed indexes items by key for diffing.
+func keyed[T any](items []T, key func(T) string) map[string]interface{} {
+	m := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		m[key(item)] = item
+	}
+	return m
+}
+
+// trackChanges diffs the current items of a kind against the previous scan
+// and publishes every change to subscribers. The items are also kept in the
+// history store.
+func (s *Scanner) trackChanges(kind string, current map[string]interface{}) {
+	now := time.Now()
+	// Processes are kept as snapshots with their hashes instead.
+	if kind != ChangeProcess {
+		storeItems(s, scanstore.KindFinding, kind, slices.Collect(maps.Values(current)), now)
+	}
+
+	changes := s.changes.update(kind, current, now)
+	if len(changes) > 0 {
+		logger.LogInfo("agentScanner.trackChanges", fmt.Sprintf("%d changes since the previous scan", len(changes)), kind, nil)
+	}
+	for _, change := range changes {
+		s.events.publish(change.Type, change)
+	}
+}
+
+// trackAppeared records an item found between scans.
+func (s *Scanner) trackAppeared(kind, key string, data interface{}) {
+	if change, ok := s.changes.add(kind, key, data, time.Now()); ok {
+		s.events.publish(change.Type, change)
+	}
+}
+
+// trackProcessScan diffs everything the process stage reports.
+func (s *Scanner) trackProcessScan(processes []ProcessNode, unsigned, malicious []ProcessInfo, relationships []RelationshipInfo, modules []ModuleFinding) {
+	s.trackChanges(ChangeProcess, keyed(processes, func(p ProcessNode) string { return p.GUID }))
+	s.trackChanges(ChangeUnsigned, keyed(unsigned, func(p ProcessInfo) string { return p.ExePath }))
+	s.trackChanges(ChangeMalicious, keyed(malicious, func(p ProcessInfo) string { return p.ExePath }))
+	s.trackChanges(ChangeRelationship, keyed(relationships, relationshipKey))
+	s.trackChanges(ChangeModule, keyed(modules, func(m ModuleFinding) string { return m.Path }))
+}
+
+// relationshipKey identifies a rule hit by the rule and the processes at
+// both ends of the chain.
+func relationshipKey(r RelationshipInfo) string {
+	ends := []string{r.Rule.ID}
+	if len(r.Chain) > 0 {
+		ends = append(ends, r.Chain[0].GUID, r.Chain[len(r.Chain)-1].GUID)
+	}
+	return strings.Join(ends, "|")
+}
+
+// listeners returns the listening TCP sockets and bound UDP sockets.
+func listeners(connections []ConnectionInfo) []ConnectionInfo {
+	var result []ConnectionInfo
+	for _, c := range connections {
+		if (c.Protocol == "tcp" && c.Status == "LISTEN") || (c.Protocol == "udp" && c.RemoteAddr == "") {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func listenerKey(c ConnectionInfo) string {
+	return fmt.Sprintf("%s|%s|%d", c.Protocol, c.LocalAddr, c.PID)
+}
+
+// ChangesSince returns the changes recorded after cursor. A cursor of 0
+// returns every change still buffered.
+func (s *Scanner) ChangesSince(cursor uint64) ChangeSet {
+	return s.changes.since(cursor)
+}
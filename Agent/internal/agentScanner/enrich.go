@@ -0,0 +1,139 @@
+package agentScanner
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/signature"
+)
+
+// exeFile holds what a process scan learned about an executable. Files over
+// the governor's size ceiling are not hashed; partialSHA256 is the hash of
+// their first bytes.
+type exeFile struct {
+	md5           string
+	sha256        string
+	partialSHA256 string
+	hashed        bool
+	size          int64
+	modTime       time.Time
+	signer        string
+	unsigned      bool
+}
+
+// inspectExecutable hashes, stats and verifies an executable, and records
+// its execution for retro-hunting.
+func (s *Scanner) inspectExecutable(ctx context.Context, exe string, scanTime time.Time) *exeFile {
+	file := s.inspectFile(ctx, exe)
+	if file.hashed {
+		s.history.record(exe, file.md5, file.sha256, scanTime)
+	}
+	return file
+}
+
+// governed runs fn in one of the governor's worker slots, after any backoff.
+// It reports false, without running fn, if ctx is done first.
+func (s *Scanner) governed(ctx context.Context, fn func()) bool {
+	release, err := s.governor.Acquire(ctx)
+	if err != nil {
+		return false
+	}
+	defer release()
+	fn()
+	return true
+}
+
+// inspectFile hashes, stats and verifies a file.
+func (s *Scanner) inspectFile(ctx context.Context, exe string) *exeFile {
+	logPrefix := "agentScanner.inspectFile"
+
+	file := &exeFile{}
+
+	if isSigned, err := s.sigVerifier.Verify(exe); err == nil {
+		file.unsigned = !isSigned
+	} else if !errors.Is(err, signature.ErrUnsupported) {
+		logger.LogError(logPrefix, "Signature verification failed", exe, err)
+	}
+	if signer, err := s.sigVerifier.Signer(exe); err == nil {
+		file.signer = signer
+	}
+
+	if info, err := os.Stat(exe); err == nil {
+		file.size = info.Size()
+		file.modTime = info.ModTime()
+	}
+
+	hashes, err := s.governor.HashFile(ctx, exe)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to calculate file hashes", exe, err)
+		return file
+	}
+	if hashes.Partial {
+		file.partialSHA256 = hashes.SHA256
+		return file
+	}
+	file.md5, file.sha256, file.hashed = hashes.MD5, hashes.SHA256, true
+	return file
+}
+
+// recordedFile is the executable of a replayed process as its snapshot
+// recorded it.
+func recordedFile(node ProcessNode) *exeFile {
+	return &exeFile{md5: node.MD5, sha256: node.SHA256, hashed: node.SHA256 != "", signer: node.Signer}
+}
+
+func newProcessInfo(node ProcessNode, file *exeFile) ProcessInfo {
+	info := ProcessInfo{
+		PID:            node.PID,
+		Name:           node.Name,
+		ExePath:        node.ExePath,
+		GUID:           node.GUID,
+		PPID:           node.PPID,
+		Cmdline:        node.Cmdline,
+		User:           node.User,
+		UID:            node.UID,
+		StartTime:      node.StartTime,
+		Cwd:            node.Cwd,
+		IntegrityLevel: node.IntegrityLevel,
+	}
+	if file != nil {
+		info.MD5 = file.md5
+		info.SHA256 = file.sha256
+		info.PartialSHA256 = file.partialSHA256
+		info.Size = file.size
+		info.ModTime = file.modTime
+		if file.signer != "" {
+			signer := file.signer
+			info.Signer = &signer
+		}
+	}
+	return info
+}
+
+var (
+	hostID     string
+	hostIDOnce sync.Once
+)
+
+// processGUID derives a stable identifier from the host, PID and start
+// time, so a later process that reuses the PID gets a different GUID. It is
+// formatted as a name-based (version 5) UUID.
+func processGUID(pid int32, start time.Time) string {
+	hostIDOnce.Do(func() {
+		hostID, _ = os.Hostname()
+	})
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s|%d|%d", hostID, pid, start.UnixMilli())
+	sum := h.Sum(nil)
+
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
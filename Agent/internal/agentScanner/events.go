@@ -0,0 +1,91 @@
+package agentScanner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+)
+
+// Event types published to subscribers.
+const (
+	EventFileCreated  = "fileCreated"
+	EventFileModified = "fileModified"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind before
+// further events are dropped for it.
+const eventBufferSize = 256
+
+// Event is a real-time notification pushed to subscribers between scans.
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// eventHub fans events out to every subscriber, and to record if set.
+type eventHub struct {
+	subscribers map[chan Event]map[string]bool
+	record      func(Event)
+	mu          sync.Mutex
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan Event]map[string]bool)}
+}
+
+// subscribe registers a subscriber for the given event types, or for all
+// types if none are given. The returned function unsubscribes.
+func (h *eventHub) subscribe(types []string) (<-chan Event, func()) {
+	var filter map[string]bool
+	if len(types) > 0 {
+		filter = make(map[string]bool, len(types))
+		for _, t := range types {
+			filter[t] = true
+		}
+	}
+
+	ch := make(chan Event, eventBufferSize)
+
+	h.mu.Lock()
+	h.subscribers[ch] = filter
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (h *eventHub) publish(eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+	if h.record != nil {
+		h.record(event)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch, filter := range h.subscribers {
+		if filter != nil && !filter[eventType] {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			logger.LogWarning("agentScanner.eventHub", "Subscriber is falling behind, event dropped", eventType)
+		}
+	}
+}
+
+// Subscribe streams real-time events of the given types, or of every type if
+// none are given, until the returned cancel function is called.
+func (s *Scanner) Subscribe(types []string) (<-chan Event, func()) {
+	return s.events.subscribe(types)
+}
@@ -0,0 +1,87 @@
+package agentScanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/fileanalysis"
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/signature"
+)
+
+// FileDetails describes a file on disk: its hashes and signer, the hash,
+// signature and path indicator findings, and for PE and ELF files the
+// static analysis with the metadata of the format. PE files also get a
+// summary of their signature.
+type FileDetails struct {
+	Path          string                 `json:"path"`
+	Size          int64                  `json:"size"`
+	ModTime       time.Time              `json:"modTime"`
+	MD5           string                 `json:"md5,omitempty"`
+	SHA256        string                 `json:"sha256,omitempty"`
+	PartialSHA256 string                 `json:"partialSha256,omitempty"`
+	Signer        *string                `json:"signer,omitempty"`
+	Findings      []string               `json:"findings,omitempty"`
+	Indicator     string                 `json:"indicator,omitempty"`
+	Signature     *signature.Summary     `json:"signature,omitempty"`
+	Analysis      *fileanalysis.Analysis `json:"analysis,omitempty"`
+}
+
+// FileDetails inspects and analyzes the file at path.
+func (s *Scanner) FileDetails(path string) (*FileDetails, error) {
+	logPrefix := "agentScanner.FileDetails"
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	file := s.inspectFile(context.Background(), path)
+	details := &FileDetails{
+		Path:          path,
+		Size:          file.size,
+		ModTime:       file.modTime,
+		MD5:           file.md5,
+		SHA256:        file.sha256,
+		PartialSHA256: file.partialSHA256,
+	}
+	if file.signer != "" {
+		signer := file.signer
+		details.Signer = &signer
+	}
+	if ioc, matched := s.threatIntel.MatchPath(path); matched {
+		details.Findings = append(details.Findings, FindingPathIndicator)
+		details.Indicator = ioc.Pattern
+	}
+	if file.hashed && s.threatIntel.IsMaliciousHash(file.md5, file.sha256) {
+		details.Findings = append(details.Findings, FindingMaliciousHash)
+	}
+	if file.unsigned {
+		details.Findings = append(details.Findings, FindingUnsigned)
+	}
+
+	// Files over the governor's size ceiling were only partly hashed and
+	// are not read in full for the analysis either.
+	if file.partialSHA256 != "" {
+		return details, nil
+	}
+	details.Analysis, err = fileanalysis.Analyze(path, s.governor.Throttle(context.Background()))
+	if err != nil && !errors.Is(err, fileanalysis.ErrUnsupportedFormat) {
+		logger.LogError(logPrefix, "Static analysis failed", path, err)
+	}
+	if details.Analysis == nil || details.Analysis.PE == nil {
+		return details, nil
+	}
+
+	details.Analysis.PE.CheckSigner(file.signer, file.unsigned)
+	if details.Signature, err = s.sigVerifier.Summary(path); err != nil {
+		logger.LogError(logPrefix, "Failed to read signature", path, err)
+	}
+	return details, nil
+}
@@ -0,0 +1,249 @@
+package agentScanner
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/fileanalysis"
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// Reasons reported in FileFinding.Findings.
+const (
+	FindingUnsigned      = "unsigned"
+	FindingMaliciousHash = "maliciousHash"
+	FindingPathIndicator = "pathIndicator"
+)
+
+type PathMatchInfo struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+}
+
+// FileFinding is a file in a sensitive directory that failed at least one
+// of the hash, signature or rule checks.
+type FileFinding struct {
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"modTime"`
+	MD5           string    `json:"md5,omitempty"`
+	SHA256        string    `json:"sha256,omitempty"`
+	PartialSHA256 string    `json:"partialSha256,omitempty"`
+	Findings      []string  `json:"findings"`
+	Indicator     string    `json:"indicator,omitempty"`
+	IndicatorType string    `json:"indicatorType,omitempty"`
+}
+
+// scanFilesystem is the filesystem stage: it walks the sensitive directories
+// and checks every file with a bounded pool of workers, each of which also
+// needs one of the governor's slots.
+func (s *Scanner) scanFilesystem(ctx context.Context) {
+	logPrefix := "agentScanner.scanFilesystem"
+	defer s.governor.ObserveScan(models.StageFilesystem, time.Now())
+
+	opts := s.filesystemOptions()
+	paths := make(chan string, opts.Workers*4)
+
+	var findings []FileFinding
+	var pathMatches []PathMatchInfo
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				var finding FileFinding
+				var ok bool
+				s.governed(ctx, func() { finding, ok = s.checkFile(ctx, path, opts) })
+				if !ok {
+					continue
+				}
+				resultsMu.Lock()
+				findings = append(findings, finding)
+				if slices.Contains(finding.Findings, FindingPathIndicator) {
+					pathMatches = append(pathMatches, PathMatchInfo{
+						Path:    finding.Path,
+						Pattern: finding.Indicator,
+						Type:    finding.IndicatorType,
+					})
+				}
+				resultsMu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	for _, dir := range s.config.SensitiveDirs {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := walkSensitiveDir(ctx, dir, opts, paths); err != nil {
+			logger.LogError(logPrefix, "Failed to walk sensitive directory", dir, err)
+		}
+	}
+	close(paths)
+	wg.Wait()
+
+	logger.LogInfo(logPrefix, fmt.Sprintf("Filesystem scan finished in %s - %d findings", time.Since(start).Round(time.Millisecond), len(findings)), "", nil)
+
+	s.mu.Lock()
+	s.fileFindingsCache = findings
+	s.pathMatchesCache = pathMatches
+	s.mu.Unlock()
+
+	s.trackChanges(ChangeFile, keyed(findings, func(f FileFinding) string { return f.Path }))
+}
+
+func (s *Scanner) filesystemOptions() models.FilesystemScan {
+	var opts models.FilesystemScan
+	if s.config.Filesystem != nil {
+		opts = *s.config.Filesystem
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = models.DefaultFilesystemWorkers
+	}
+	if opts.MaxFileSizeMB <= 0 {
+		opts.MaxFileSizeMB = models.DefaultMaxFileSizeMB
+	}
+	return opts
+}
+
+// walkSensitiveDir feeds every regular file under root to the workers,
+// honouring the depth limit and exclusions.
+func walkSensitiveDir(ctx context.Context, root string, opts models.FilesystemScan, paths chan<- string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped, the rest of the tree is still walked.
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isExcluded(path, opts.Exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if opts.MaxDepth > 0 && path != root && dirDepth(root, path) > opts.MaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		select {
+		case paths <- path:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	})
+}
+
+func dirDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// isExcluded matches exclusion globs against the full path and the base name.
+func isExcluded(path string, patterns []string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFile runs a single file through the rule, hash and signature checks.
+// It reports false if the file is clean or could not be checked.
+func (s *Scanner) checkFile(ctx context.Context, path string, opts models.FilesystemScan) (FileFinding, bool) {
+	logPrefix := "agentScanner.checkFile"
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileFinding{}, false
+	}
+
+	finding := FileFinding{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	if ioc, matched := s.threatIntel.MatchPath(path); matched {
+		finding.Findings = append(finding.Findings, FindingPathIndicator)
+		finding.Indicator = ioc.Pattern
+		finding.IndicatorType = ioc.Type
+	}
+
+	if info.Size() <= opts.MaxFileSizeMB*1024*1024 {
+		hashes, err := s.governor.HashFile(ctx, path)
+		if err != nil {
+			logger.LogError(logPrefix, "Failed to calculate file hashes", path, err)
+		} else if hashes.Partial {
+			finding.PartialSHA256 = hashes.SHA256
+		} else {
+			finding.MD5 = hashes.MD5
+			finding.SHA256 = hashes.SHA256
+			if s.threatIntel.IsMaliciousHash(hashes.MD5, hashes.SHA256) {
+				finding.Findings = append(finding.Findings, FindingMaliciousHash)
+			}
+		}
+	}
+
+	if isExecutable(path, info) {
+		if isSigned, err := s.sigVerifier.Verify(path); err == nil && !isSigned {
+			finding.Findings = append(finding.Findings, FindingUnsigned)
+		}
+	}
+
+	return finding, len(finding.Findings) > 0
+}
+
+// isExecutable reports whether a file is a program. Linux droppers rarely
+// have an extension, so PE and ELF images are recognized by their content
+// and, outside Windows, any file with an execute bit counts.
+func isExecutable(path string, info fs.FileInfo) bool {
+	if slices.Contains(models.ExecutableExtensions, strings.ToLower(filepath.Ext(path))) {
+		return true
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o111 != 0 {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return fileanalysis.Sniff(f) != ""
+}
+
+func (s *Scanner) GetFileFindings() []FileFinding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fileFindingsCache
+}
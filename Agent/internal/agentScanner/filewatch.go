@@ -0,0 +1,208 @@
+package agentScanner
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileEvent is published when an executable in a sensitive directory is
+// created or modified. Finding is set if the file failed a check.
+type FileEvent struct {
+	Path    string       `json:"path"`
+	Finding *FileFinding `json:"finding,omitempty"`
+}
+
+// fileWatcher watches the sensitive directories and checks executables that
+// change, once the burst of writes to them has settled.
+type fileWatcher struct {
+	scanner  *Scanner
+	watcher  *fsnotify.Watcher
+	opts     models.FilesystemScan
+	debounce time.Duration
+	roots    []string
+
+	// pending maps a path to its event type and the time of its last write.
+	pending map[string]pendingChange
+}
+
+type pendingChange struct {
+	eventType string
+	lastSeen  time.Time
+}
+
+func (s *Scanner) startFileWatcher(ctx context.Context) {
+	logPrefix := "agentScanner.startFileWatcher"
+
+	rt := s.config.Realtime
+	if rt == nil || !rt.Enabled {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to create file watcher", "", err)
+		return
+	}
+
+	debounce := time.Duration(rt.DebounceMillis) * time.Millisecond
+	if debounce <= 0 {
+		debounce = models.DefaultDebounceMillis * time.Millisecond
+	}
+
+	fw := &fileWatcher{
+		scanner:  s,
+		watcher:  watcher,
+		opts:     s.filesystemOptions(),
+		debounce: debounce,
+		roots:    s.config.SensitiveDirs,
+		pending:  make(map[string]pendingChange),
+	}
+
+	for _, root := range fw.roots {
+		fw.addTree(root, root)
+	}
+
+	logger.LogInfo(logPrefix, "Watching sensitive directories", "", len(watcher.WatchList()))
+	go fw.run(ctx)
+}
+
+// addTree watches dir and its subdirectories within the depth limit.
+func (fw *fileWatcher) addTree(root, dir string) {
+	logPrefix := "agentScanner.fileWatcher"
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if isExcluded(path, fw.opts.Exclude) {
+			return filepath.SkipDir
+		}
+		if fw.opts.MaxDepth > 0 && path != root && dirDepth(root, path) > fw.opts.MaxDepth {
+			return filepath.SkipDir
+		}
+		if err := fw.watcher.Add(path); err != nil {
+			logger.LogWarning(logPrefix, "Failed to watch directory", path, err)
+		}
+		return nil
+	})
+}
+
+func (fw *fileWatcher) run(ctx context.Context) {
+	logPrefix := "agentScanner.fileWatcher"
+
+	defer fw.watcher.Close()
+
+	ticker := time.NewTicker(fw.debounce / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-fw.watcher.Events:
+			if !ok {
+				return
+			}
+			fw.handle(event)
+
+		case err, ok := <-fw.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.LogError(logPrefix, "File watcher error", "", err)
+
+		case <-ticker.C:
+			fw.flush(ctx)
+
+		case <-ctx.Done():
+			logger.LogInfo(logPrefix, "File watcher shutting down", "", nil)
+			return
+		}
+	}
+}
+
+func (fw *fileWatcher) handle(event fsnotify.Event) {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) && !event.Has(fsnotify.Chmod) {
+		return
+	}
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if root := fw.rootOf(event.Name); root != "" {
+				fw.addTree(root, event.Name)
+			}
+			return
+		}
+	}
+
+	// Whether the file is executable is decided in flush, once the dropper
+	// has finished writing it and setting its mode.
+	if isExcluded(event.Name, fw.opts.Exclude) {
+		return
+	}
+
+	change, exists := fw.pending[event.Name]
+	if !exists {
+		change.eventType = EventFileModified
+		if event.Has(fsnotify.Create) {
+			change.eventType = EventFileCreated
+		}
+	}
+	change.lastSeen = time.Now()
+	fw.pending[event.Name] = change
+}
+
+func (fw *fileWatcher) rootOf(path string) string {
+	for _, root := range fw.roots {
+		if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return root
+		}
+	}
+	return ""
+}
+
+// flush checks every pending file that has been quiet for the debounce period.
+func (fw *fileWatcher) flush(ctx context.Context) {
+	now := time.Now()
+	for path, change := range fw.pending {
+		if now.Sub(change.lastSeen) < fw.debounce {
+			continue
+		}
+		delete(fw.pending, path)
+
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || !isExecutable(path, info) {
+			continue
+		}
+
+		event := FileEvent{Path: path}
+		if finding, ok := fw.scanner.checkFile(ctx, path, fw.opts); ok {
+			event.Finding = &finding
+			fw.scanner.recordFileFinding(finding)
+			fw.scanner.trackAppeared(ChangeFile, finding.Path, finding)
+			logger.LogInfo("agentScanner.fileWatcher", "Real-time check flagged file", path, finding.Findings)
+		}
+		fw.scanner.events.publish(change.eventType, event)
+	}
+}
+
+// recordFileFinding adds or replaces the finding for a file between scans.
+func (s *Scanner) recordFileFinding(finding FileFinding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Readers may still hold the old slice, so it is copied rather than edited.
+	findings := make([]FileFinding, 0, len(s.fileFindingsCache)+1)
+	for _, f := range s.fileFindingsCache {
+		if f.Path != finding.Path {
+			findings = append(findings, f)
+		}
+	}
+	s.fileFindingsCache = append(findings, finding)
+}
@@ -0,0 +1,143 @@
+package agentScanner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/threatintel"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// ExecutionRecord is a binary the scanner has seen running, identified by
+// path and content hash so a replaced binary gets its own record.
+type ExecutionRecord struct {
+	ExePath   string    `json:"exePath"`
+	MD5       string    `json:"md5"`
+	SHA256    string    `json:"sha256"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// RetroHuntHit is a previously executed binary that matches an indicator
+// added after it was seen.
+type RetroHuntHit struct {
+	ExecutionRecord
+	Kind       string    `json:"kind"`
+	Indicator  string    `json:"indicator"`
+	Type       string    `json:"type,omitempty"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// executionHistory is a bounded set of execution records. When full, the
+// record that was seen least recently is evicted.
+type executionHistory struct {
+	records map[string]*ExecutionRecord
+	maxSize int
+	mu      sync.Mutex
+}
+
+func newExecutionHistory(maxSize int) *executionHistory {
+	if maxSize <= 0 {
+		maxSize = models.DefaultHistorySize
+	}
+	return &executionHistory{
+		records: make(map[string]*ExecutionRecord),
+		maxSize: maxSize,
+	}
+}
+
+func (h *executionHistory) record(exePath, md5Hash, sha256Hash string, seen time.Time) {
+	key := exePath + "|" + sha256Hash
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if rec, ok := h.records[key]; ok {
+		rec.LastSeen = seen
+		return
+	}
+
+	if len(h.records) >= h.maxSize {
+		h.evictOldest()
+	}
+
+	h.records[key] = &ExecutionRecord{
+		ExePath:   exePath,
+		MD5:       md5Hash,
+		SHA256:    sha256Hash,
+		FirstSeen: seen,
+		LastSeen:  seen,
+	}
+}
+
+func (h *executionHistory) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, rec := range h.records {
+		if oldestKey == "" || rec.LastSeen.Before(oldest) {
+			oldestKey = key
+			oldest = rec.LastSeen
+		}
+	}
+	delete(h.records, oldestKey)
+}
+
+func (h *executionHistory) snapshot() []ExecutionRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	records := make([]ExecutionRecord, 0, len(h.records))
+	for _, rec := range h.records {
+		records = append(records, *rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].FirstSeen.Before(records[j].FirstSeen)
+	})
+	return records
+}
+
+// retroHunt matches newly added indicators against every binary recorded in
+// the execution history.
+func (s *Scanner) retroHunt(delta threatintel.IndicatorDelta) {
+	logPrefix := "agentScanner.retroHunt"
+
+	var hits []RetroHuntHit
+	for _, rec := range s.history.snapshot() {
+		hit := RetroHuntHit{ExecutionRecord: rec, DetectedAt: delta.LoadedAt}
+
+		if hash, matched := delta.MatchHash(rec.MD5, rec.SHA256); matched {
+			hit.Kind = "hash"
+			hit.Indicator = hash
+		} else if ioc, matched := delta.MatchPath(rec.ExePath); matched {
+			hit.Kind = "path"
+			hit.Indicator = ioc.Pattern
+			hit.Type = ioc.Type
+		} else {
+			continue
+		}
+
+		logger.LogInfo(logPrefix, fmt.Sprintf("[RetroHunt] Host ran now-known-malicious binary %s on %s", rec.ExePath, rec.FirstSeen.Format(time.RFC3339)), "", hit.Indicator)
+		hits = append(hits, hit)
+	}
+
+	logger.LogInfo(logPrefix, fmt.Sprintf("Retro-hunt matched %d historical binaries", len(hits)), "", nil)
+	if len(hits) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.retroHuntCache = append(s.retroHuntCache, hits...)
+	if overflow := len(s.retroHuntCache) - models.MaxRetroHuntHits; overflow > 0 {
+		s.retroHuntCache = s.retroHuntCache[overflow:]
+	}
+	s.mu.Unlock()
+}
+
+func (s *Scanner) GetRetroHuntHits() []RetroHuntHit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retroHuntCache
+}
@@ -0,0 +1,122 @@
+package agentScanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+)
+
+// Snapshot types kept in the history store.
+const (
+	SnapshotProcess    = "process"
+	SnapshotConnection = "connection"
+)
+
+// SetHistoryStore makes the scanner keep its findings, snapshots and events
+// in store. It must be called before StartBackground.
+func (s *Scanner) SetHistoryStore(store *scanstore.Store) {
+	s.store = store
+	s.events.record = s.storeEvent
+}
+
+// QueryHistory returns the stored records matching q.
+func (s *Scanner) QueryHistory(q scanstore.Query) (scanstore.QueryResult, error) {
+	if s.store == nil {
+		return scanstore.QueryResult{}, fmt.Errorf("history store is not enabled")
+	}
+	return s.store.Query(q)
+}
+
+// storeItems keeps every item of a scan as a record of the given kind and
+// type.
+func storeItems[T any](s *Scanner, kind, recordType string, items []T, now time.Time) {
+	if s.store == nil || len(items) == 0 {
+		return
+	}
+	records := make([]scanstore.Record, 0, len(items))
+	for _, item := range items {
+		if record, ok := newRecord(kind, recordType, now, item); ok {
+			records = append(records, record)
+		}
+	}
+	s.store.Add(records...)
+}
+
+// storeProcessSnapshot keeps the processes of a scan with the hashes of
+// their executables.
+func (s *Scanner) storeProcessSnapshot(processes []ProcessNode, files map[string]*exeFile, now time.Time) {
+	if s.store == nil {
+		return
+	}
+	snapshot := make([]ProcessInfo, 0, len(processes))
+	for _, p := range processes {
+		snapshot = append(snapshot, newProcessInfo(p, files[p.ExePath]))
+	}
+	storeItems(s, scanstore.KindSnapshot, SnapshotProcess, snapshot, now)
+}
+
+func (s *Scanner) storeEvent(event Event) {
+	if record, ok := newRecord(scanstore.KindEvent, event.Type, event.Time, event.Data); ok {
+		s.store.Add(record)
+	}
+}
+
+func newRecord(kind, recordType string, t time.Time, data interface{}) (scanstore.Record, bool) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		logger.LogError("agentScanner.newRecord", "Failed to marshal history record", recordType, err)
+		return scanstore.Record{}, false
+	}
+	record := scanstore.Record{Time: t, Kind: kind, Type: recordType, Data: raw}
+	record.PID, record.ExePath, record.Hashes = recordKeys(data)
+	return record, true
+}
+
+// recordKeys picks the process, executable and hashes a record is about.
+func recordKeys(data interface{}) (int32, string, []string) {
+	switch v := data.(type) {
+	case ProcessInfo:
+		return v.PID, v.ExePath, hashes(v.MD5, v.SHA256, v.PartialSHA256)
+	case ProcessNode:
+		return v.PID, v.ExePath, nil
+	case ProcessEvent:
+		return v.PID, v.ExePath, hashes(v.MD5, v.SHA256)
+	case RelationshipInfo:
+		return v.ChildPID, v.ChildPath, nil
+	case MasqueradeInfo:
+		return v.PID, v.ExePath, nil
+	case ImageFinding:
+		return v.PID, v.ExePath, hashes(v.ImageMD5, v.ImageSHA256, v.DiskSHA256)
+	case AnomalyInfo:
+		return v.PID, v.ExePath, nil
+	case ConnectionInfo:
+		return v.PID, "", nil
+	case ModuleFinding:
+		return 0, v.Path, hashes(v.MD5, v.SHA256)
+	case FileFinding:
+		return 0, v.Path, hashes(v.MD5, v.SHA256, v.PartialSHA256)
+	case FileEvent:
+		if v.Finding != nil {
+			return recordKeys(*v.Finding)
+		}
+		return 0, v.Path, nil
+	case PersistenceEntry:
+		return 0, v.ExePath, hashes(v.MD5, v.SHA256)
+	case Change:
+		return recordKeys(v.Data)
+	}
+	return 0, "", nil
+}
+
+func hashes(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
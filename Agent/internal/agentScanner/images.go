@@ -0,0 +1,48 @@
+package agentScanner
+
+import (
+	"time"
+)
+
+// Reasons reported in ImageFinding.Findings.
+const (
+	FindingDeletedExecutable  = "deletedExecutable"
+	FindingReplacedExecutable = "replacedExecutable"
+	FindingMemoryOnly         = "memoryOnlyExecutable"
+	FindingAnonymousMemory    = "anonymousExecutableMemory"
+)
+
+// ImageFinding is a process whose running image no longer matches a file on
+// disk: the executable was deleted or replaced after the process started,
+// or the code runs from memory only. ImageSHA256 is the hash of the image
+// the process runs, DiskSHA256 that of the file now at ExePath.
+type ImageFinding struct {
+	PID         int32     `json:"pid"`
+	Name        string    `json:"name"`
+	ExePath     string    `json:"exePath,omitempty"`
+	Cmdline     string    `json:"cmdline,omitempty"`
+	GUID        string    `json:"guid"`
+	User        string    `json:"user,omitempty"`
+	StartTime   time.Time `json:"startTime"`
+	Findings    []string  `json:"findings"`
+	Details     []string  `json:"details"`
+	ImageMD5    string    `json:"imageMd5,omitempty"`
+	ImageSHA256 string    `json:"imageSha256,omitempty"`
+	DiskSHA256  string    `json:"diskSha256,omitempty"`
+}
+
+func (s *Scanner) imageChecksEnabled() bool {
+	return s.config.ImageChecks != nil && s.config.ImageChecks.Enabled
+}
+
+func (s *Scanner) anonymousMemoryEnabled() bool {
+	return s.config.ImageChecks != nil && s.config.ImageChecks.AnonymousMemory
+}
+
+// GetImageFindings returns the deleted, replaced and memory-only executables
+// found by the last process scan.
+func (s *Scanner) GetImageFindings() []ImageFinding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.imageFindingsCache
+}
@@ -0,0 +1,144 @@
+package agentScanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/governor"
+)
+
+// deletedSuffix is appended by the kernel to links and mappings of files
+// that were unlinked while in use.
+const deletedSuffix = " (deleted)"
+
+// memfdPrefix starts the name of files created by memfd_create, which live
+// in memory only.
+const memfdPrefix = "/memfd:"
+
+func isDeletedPath(path string) bool {
+	return strings.HasSuffix(path, deletedSuffix) || strings.HasPrefix(path, memfdPrefix)
+}
+
+// checkImage compares the image a process runs with the file at its
+// executable path. /proc/<pid>/exe still opens the running image when the
+// file is gone, and paths are resolved under /proc/<pid>/root so processes
+// in containers are compared with their own filesystem.
+func (s *Scanner) checkImage(ctx context.Context, node ProcessNode, scanTime time.Time) (ImageFinding, bool) {
+	procDir := filepath.Join("/proc", strconv.Itoa(int(node.PID)))
+	finding := ImageFinding{
+		PID:       node.PID,
+		Name:      node.Name,
+		ExePath:   strings.TrimSuffix(node.ExePath, deletedSuffix),
+		Cmdline:   node.Cmdline,
+		GUID:      node.GUID,
+		User:      node.User,
+		StartTime: node.StartTime,
+	}
+	addFinding := func(reason, detail string) {
+		finding.Findings = append(finding.Findings, reason)
+		finding.Details = append(finding.Details, detail)
+	}
+
+	if node.ExePath != "" {
+		exe := filepath.Join(procDir, "exe")
+		switch {
+		case strings.HasPrefix(node.ExePath, memfdPrefix):
+			addFinding(FindingMemoryOnly, fmt.Sprintf("runs from memory file %s", finding.ExePath))
+			s.hashImage(ctx, &finding, exe, scanTime)
+
+		case strings.HasSuffix(node.ExePath, deletedSuffix):
+			onDisk := filepath.Join(procDir, "root", finding.ExePath)
+			if _, err := os.Stat(onDisk); err != nil {
+				addFinding(FindingDeletedExecutable, "executable was deleted after the process started")
+				s.hashImage(ctx, &finding, exe, scanTime)
+			} else if image, ok := s.hashImage(ctx, &finding, exe, scanTime); ok {
+				// Over the size ceiling both are partial hashes of the same
+				// length, which still tell the files apart.
+				if disk, err := s.governor.HashFile(ctx, onDisk); err == nil && disk != image {
+					if !disk.Partial {
+						finding.DiskSHA256 = disk.SHA256
+					}
+					addFinding(FindingReplacedExecutable, "executable on disk differs from the running image")
+				}
+			}
+		}
+	}
+
+	if regions := memoryRegions(procDir, s.anonymousMemoryEnabled()); len(regions) > 0 {
+		for _, region := range regions {
+			if region == node.ExePath {
+				continue
+			}
+			if strings.HasPrefix(region, memfdPrefix) {
+				addFinding(FindingMemoryOnly, fmt.Sprintf("maps memory file %s executable", strings.TrimSuffix(region, deletedSuffix)))
+			} else {
+				addFinding(FindingAnonymousMemory, fmt.Sprintf("has writable and executable anonymous memory at %s", region))
+			}
+		}
+	}
+
+	if len(finding.Findings) == 0 {
+		return ImageFinding{}, false
+	}
+	if finding.ImageSHA256 != "" && s.threatIntel.IsMaliciousHash(finding.ImageMD5, finding.ImageSHA256) {
+		addFinding(FindingMaliciousHash, "running image matches a known malicious hash")
+	}
+	return finding, true
+}
+
+// hashImage hashes the image a process runs and records it for
+// retro-hunting, as the file may no longer exist anywhere else. Images over
+// the size ceiling only get a partial hash, which is not recorded.
+func (s *Scanner) hashImage(ctx context.Context, finding *ImageFinding, exe string, scanTime time.Time) (governor.Hashes, bool) {
+	hashes, err := s.governor.HashFile(ctx, exe)
+	if err != nil {
+		return governor.Hashes{}, false
+	}
+	if !hashes.Partial {
+		finding.ImageMD5, finding.ImageSHA256 = hashes.MD5, hashes.SHA256
+		s.history.record(finding.ExePath, hashes.MD5, hashes.SHA256, scanTime)
+	}
+	return hashes, true
+}
+
+// memoryRegions returns the executable mappings of memory files and, if
+// anonymous is set, the address ranges of writable and executable anonymous
+// mappings. JIT compilers create the latter routinely.
+func memoryRegions(procDir string, anonymous bool) []string {
+	f, err := os.Open(filepath.Join(procDir, "maps"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var regions []string
+	seen := make(map[string]bool)
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		// address perms offset dev inode pathname
+		fields := strings.SplitN(lines.Text(), " ", 6)
+		if len(fields) < 5 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		var path string
+		if len(fields) == 6 {
+			path = strings.TrimSpace(fields[5])
+		}
+		switch {
+		case strings.HasPrefix(path, memfdPrefix):
+			if !seen[path] {
+				seen[path] = true
+				regions = append(regions, path)
+			}
+		case anonymous && (path == "" || strings.HasPrefix(path, "[anon")) && strings.Contains(fields[1], "w"):
+			regions = append(regions, fields[0])
+		}
+	}
+	return regions
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package agentScanner
+
+import (
+	"context"
+	"time"
+)
+
+// checkImage finds nothing outside Linux, where a running executable cannot
+// be deleted or replaced and /proc does not expose the mapped image.
+func (s *Scanner) checkImage(ctx context.Context, node ProcessNode, scanTime time.Time) (ImageFinding, bool) {
+	return ImageFinding{}, false
+}
+
+// isDeletedPath reports whether an executable path refers to a file that is
+// gone. Only Linux reports such paths.
+func isDeletedPath(path string) bool {
+	return false
+}
@@ -0,0 +1,310 @@
+package agentScanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// Anomaly types reported in AnomalyInfo.Type.
+const (
+	AnomalyParentChild = "parentChild"
+	AnomalyExePath     = "exePath"
+	AnomalyUser        = "user"
+)
+
+// EventAnomaly is published to subscribers for every anomaly.
+const EventAnomaly = "anomaly"
+
+// FindingAnomaly marks a process event that broke the learned baseline.
+const FindingAnomaly = "anomaly"
+
+// AnomalyInfo is a combination never seen before on this host. Context is
+// what the combination was looked up under (the child name, the process name
+// or the executable) and Seen how often that context was observed. Rarity
+// runs from 0 to 1 and grows with Seen, so a new parent for a process seen
+// thousands of times scores higher than one for a process seen twice.
+type AnomalyInfo struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	PID        int32     `json:"pid"`
+	GUID       string    `json:"guid,omitempty"`
+	Name       string    `json:"name"`
+	ExePath    string    `json:"exePath,omitempty"`
+	User       string    `json:"user,omitempty"`
+	ParentName string    `json:"parentName,omitempty"`
+	Context    string    `json:"context"`
+	Value      string    `json:"value"`
+	Seen       int64     `json:"seen"`
+	Rarity     float64   `json:"rarity"`
+}
+
+// LearnedBaseline counts how often each combination was observed. Each map
+// is keyed by the context first: child name to parent names, process name
+// to executable paths, and executable path to users.
+type LearnedBaseline struct {
+	TrainingStarted time.Time                   `json:"trainingStarted"`
+	TrainingEnds    time.Time                   `json:"trainingEnds"`
+	ParentChild     map[string]map[string]int64 `json:"parentChild"`
+	ExePaths        map[string]map[string]int64 `json:"exePaths"`
+	Users           map[string]map[string]int64 `json:"users"`
+}
+
+func newLearnedBaseline(now time.Time, training time.Duration) LearnedBaseline {
+	return LearnedBaseline{
+		TrainingStarted: now,
+		TrainingEnds:    now.Add(training),
+		ParentChild:     make(map[string]map[string]int64),
+		ExePaths:        make(map[string]map[string]int64),
+		Users:           make(map[string]map[string]int64),
+	}
+}
+
+// baselineLearner learns the host's baseline during the training window and
+// afterwards reports combinations it has never seen. New combinations are
+// still learned after training, so each one is reported once.
+type baselineLearner struct {
+	path      string
+	training  time.Duration
+	baseline  LearnedBaseline
+	dirty     bool
+	anomalies []AnomalyInfo
+	mu        sync.Mutex
+}
+
+// learnerObservation is a process together with its parent, if known.
+type learnerObservation struct {
+	node   ProcessNode
+	parent string
+}
+
+func newBaselineLearner(cfg *models.LearningConfig) *baselineLearner {
+	logPrefix := "agentScanner.newBaselineLearner"
+
+	training := time.Duration(cfg.TrainingHours) * time.Hour
+	if training <= 0 {
+		training = models.DefaultTrainingHours * time.Hour
+	}
+	l := &baselineLearner{path: cfg.Path, training: training}
+
+	if err := l.load(); err != nil {
+		logger.LogError(logPrefix, "Failed to load learned baseline, starting training again", l.path, err)
+	}
+	if l.baseline.ParentChild == nil {
+		l.baseline = newLearnedBaseline(time.Now(), training)
+		l.dirty = true
+		logger.LogInfo(logPrefix, "Started baseline training", l.path, l.baseline.TrainingEnds)
+	}
+	return l
+}
+
+func (l *baselineLearner) load() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var baseline LearnedBaseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return fmt.Errorf("failed to unmarshal baseline: %w", err)
+	}
+	for _, m := range []*map[string]map[string]int64{&baseline.ParentChild, &baseline.ExePaths, &baseline.Users} {
+		if *m == nil {
+			*m = make(map[string]map[string]int64)
+		}
+	}
+	l.baseline = baseline
+	return nil
+}
+
+// save writes the baseline if it changed since it was last saved.
+func (l *baselineLearner) save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" || !l.dirty {
+		return nil
+	}
+	data, err := json.Marshal(l.baseline)
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+	if err := writeFileAtomic(l.path, data); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// observe learns the observations and, once training is over, returns the
+// combinations that were never seen before.
+func (l *baselineLearner) observe(observations []learnerObservation, now time.Time) []AnomalyInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	training := now.Before(l.baseline.TrainingEnds)
+	var anomalies []AnomalyInfo
+	for _, obs := range observations {
+		node := obs.node
+		name := strings.ToLower(node.Name)
+		checks := []struct {
+			kind    string
+			counts  map[string]map[string]int64
+			context string
+			value   string
+		}{
+			{AnomalyParentChild, l.baseline.ParentChild, name, strings.ToLower(obs.parent)},
+			{AnomalyExePath, l.baseline.ExePaths, name, node.ExePath},
+			{AnomalyUser, l.baseline.Users, node.ExePath, node.User},
+		}
+		for _, check := range checks {
+			if check.context == "" || check.value == "" {
+				continue
+			}
+			seen, count := l.learn(check.counts, check.context, check.value)
+			if training || count > 0 {
+				continue
+			}
+			anomaly := AnomalyInfo{
+				Type:       check.kind,
+				Time:       now,
+				PID:        node.PID,
+				GUID:       node.GUID,
+				Name:       node.Name,
+				ExePath:    node.ExePath,
+				User:       node.User,
+				ParentName: obs.parent,
+				Context:    check.context,
+				Value:      check.value,
+				Seen:       seen,
+				Rarity:     rarity(seen),
+			}
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	l.anomalies = append(l.anomalies, anomalies...)
+	if overflow := len(l.anomalies) - models.MaxAnomalies; overflow > 0 {
+		l.anomalies = l.anomalies[overflow:]
+	}
+	return anomalies
+}
+
+// learn counts one observation and returns how often the context and the
+// combination had been seen before it. Callers hold mu.
+func (l *baselineLearner) learn(counts map[string]map[string]int64, context, value string) (seen, count int64) {
+	values, ok := counts[context]
+	if !ok {
+		values = make(map[string]int64)
+		counts[context] = values
+	}
+	for _, n := range values {
+		seen += n
+	}
+	count = values[value]
+	values[value]++
+	l.dirty = true
+	return seen, count
+}
+
+// rarity scores a never-seen combination by how well established its
+// context is: the chance, with add-one smoothing, that the next observation
+// would not have been this new value.
+func rarity(seen int64) float64 {
+	score := 1 - 1/float64(seen+2)
+	return math.Round(score*1000) / 1000
+}
+
+func (l *baselineLearner) recent() []AnomalyInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]AnomalyInfo(nil), l.anomalies...)
+}
+
+// export returns the learned baseline as JSON.
+func (l *baselineLearner) export() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return json.Marshal(l.baseline)
+}
+
+// reset forgets everything learned and starts a new training window.
+func (l *baselineLearner) reset(now time.Time) error {
+	l.mu.Lock()
+	l.baseline = newLearnedBaseline(now, l.training)
+	l.anomalies = nil
+	l.dirty = true
+	l.mu.Unlock()
+
+	logger.LogInfo("agentScanner.baselineLearner", "Baseline reset, training again", l.path, l.baseline.TrainingEnds)
+	return l.save()
+}
+
+// learnProcesses feeds a process scan to the learner and saves what was
+// learned since the previous scan, including from process events.
+func (s *Scanner) learnProcesses(processes []ProcessNode, now time.Time) []AnomalyInfo {
+	if s.learner == nil {
+		return nil
+	}
+	observations := make([]learnerObservation, 0, len(processes))
+	for _, node := range processes {
+		obs := learnerObservation{node: node}
+		if parent, ok := s.procTable.parentOf(node); ok {
+			obs.parent = parent.Name
+		}
+		observations = append(observations, obs)
+	}
+	anomalies := s.reportAnomalies(s.learner.observe(observations, now))
+
+	if err := s.learner.save(); err != nil {
+		logger.LogError("agentScanner.learnProcesses", "Failed to save learned baseline", s.learner.path, err)
+	}
+	return anomalies
+}
+
+// reportAnomalies logs and publishes anomalies.
+func (s *Scanner) reportAnomalies(anomalies []AnomalyInfo) []AnomalyInfo {
+	for _, anomaly := range anomalies {
+		logger.LogInfo("agentScanner.reportAnomalies", fmt.Sprintf("[Anomaly] %s: %s %q never seen (rarity %.3f)", anomaly.Type, anomaly.Context, anomaly.Value, anomaly.Rarity), anomaly.ExePath, anomaly.PID)
+		s.events.publish(EventAnomaly, anomaly)
+	}
+	return anomalies
+}
+
+// GetAnomalies returns the most recent anomalies.
+func (s *Scanner) GetAnomalies() []AnomalyInfo {
+	if s.learner == nil {
+		return nil
+	}
+	return s.learner.recent()
+}
+
+// ExportBaseline returns the learned baseline as JSON.
+func (s *Scanner) ExportBaseline() ([]byte, error) {
+	if s.learner == nil {
+		return nil, errors.New("baseline learning is disabled")
+	}
+	return s.learner.export()
+}
+
+// ResetBaseline forgets the learned baseline and starts training again.
+func (s *Scanner) ResetBaseline() error {
+	if s.learner == nil {
+		return errors.New("baseline learning is disabled")
+	}
+	return s.learner.reset(time.Now())
+}
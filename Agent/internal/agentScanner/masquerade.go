@@ -0,0 +1,89 @@
+package agentScanner
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/rules"
+)
+
+// FindingMasquerade marks a process imitating a system binary.
+const FindingMasquerade = "masquerade"
+
+// MasqueradeInfo is a process that imitates a system binary, with every
+// reason it was flagged.
+type MasqueradeInfo struct {
+	PID        int32                   `json:"pid"`
+	Name       string                  `json:"name"`
+	ExePath    string                  `json:"exePath,omitempty"`
+	Cmdline    string                  `json:"cmdline,omitempty"`
+	GUID       string                  `json:"guid"`
+	User       string                  `json:"user,omitempty"`
+	ParentPID  int32                   `json:"parentPid"`
+	ParentName string                  `json:"parentName,omitempty"`
+	ParentPath string                  `json:"parentPath,omitempty"`
+	Findings   []rules.MasqueradeMatch `json:"findings"`
+}
+
+// SetMasqueradeChecker enables the masquerading check of the process stage.
+// It must be called before StartBackground.
+func (s *Scanner) SetMasqueradeChecker(checker *rules.MasqueradeChecker) {
+	s.masquerade = checker
+}
+
+// matchMasquerades checks every process of a scan for masquerading.
+func (s *Scanner) matchMasquerades(table map[int32]ProcessNode) []MasqueradeInfo {
+	logPrefix := "agentScanner.matchMasquerades"
+
+	if s.masquerade == nil {
+		return nil
+	}
+
+	var hits []MasqueradeInfo
+	for _, node := range table {
+		matches, parent := s.checkMasquerade(node)
+		if len(matches) == 0 {
+			continue
+		}
+		hit := MasqueradeInfo{
+			PID:       node.PID,
+			Name:      node.Name,
+			ExePath:   node.ExePath,
+			Cmdline:   node.Cmdline,
+			GUID:      node.GUID,
+			User:      node.User,
+			ParentPID: node.PPID,
+			Findings:  matches,
+		}
+		if parent != nil {
+			hit.ParentName, hit.ParentPath = parent.Name, parent.ExePath
+		}
+		logger.LogInfo(logPrefix, fmt.Sprintf("[Suspicious] %s (%d) imitates %s: %s", node.Name, node.PID, matches[0].Imitates, matches[0].Reason), node.ExePath, matches)
+		hits = append(hits, hit)
+	}
+	slices.SortFunc(hits, func(a, b MasqueradeInfo) int { return cmp.Compare(a.PID, b.PID) })
+	return hits
+}
+
+// checkMasquerade runs the masquerade table over a process and returns its
+// parent, if known, along with the matches.
+func (s *Scanner) checkMasquerade(node ProcessNode) ([]rules.MasqueradeMatch, *ProcessNode) {
+	if s.masquerade == nil {
+		return nil, nil
+	}
+	parent, ok := s.procTable.parentOf(node)
+	if !ok {
+		return s.masquerade.Check(node.ruleProcess(), nil), nil
+	}
+	parentProcess := parent.ruleProcess()
+	return s.masquerade.Check(node.ruleProcess(), &parentProcess), &parent
+}
+
+// GetMasquerades returns the masquerading processes found by the last process scan.
+func (s *Scanner) GetMasquerades() []MasqueradeInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.masqueradesCache
+}
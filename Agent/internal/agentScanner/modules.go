@@ -0,0 +1,164 @@
+package agentScanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+)
+
+// FindingUnsignedInSigned marks an unsigned module loaded into a process
+// whose own executable is signed, the usual sign of DLL injection or
+// search-order hijacking.
+const FindingUnsignedInSigned = "unsignedInSignedProcess"
+
+// ModuleFinding is a loaded module or shared library that failed the hash,
+// signature or path indicator checks, with the processes that loaded it.
+type ModuleFinding struct {
+	Path      string       `json:"path"`
+	MD5       string       `json:"md5,omitempty"`
+	SHA256    string       `json:"sha256,omitempty"`
+	Size      int64        `json:"size"`
+	Signer    *string      `json:"signer,omitempty"`
+	Findings  []string     `json:"findings"`
+	Indicator string       `json:"indicator,omitempty"`
+	Processes []ProcessRef `json:"processes"`
+}
+
+// scanModules checks every module loaded by the scanned processes. files
+// holds the executables already inspected by the scan and is shared so a
+// binary is never hashed twice.
+func (s *Scanner) scanModules(ctx context.Context, processes []ProcessNode, files map[string]*exeFile, scanTime time.Time) []ModuleFinding {
+	logPrefix := "agentScanner.scanModules"
+
+	findings := make(map[string]*ModuleFinding)
+	var order []string
+	// Clean modules hashed by this pass, by hash, and the processes that
+	// loaded them, in case the reputation provider knows better.
+	unknown := make(map[string][]string)
+	loadedBy := make(map[string][]ProcessRef)
+
+	for _, p := range processes {
+		if ctx.Err() != nil {
+			break
+		}
+		modules, err := listModules(p.PID)
+		if err != nil {
+			// Processes of other users and protected processes cannot be read.
+			continue
+		}
+
+		host := files[p.ExePath]
+		for _, path := range modules {
+			if path == p.ExePath || isExcluded(path, s.moduleExclusions()) {
+				continue
+			}
+
+			file, seen := files[path]
+			if !seen {
+				if !s.governed(ctx, func() { file = s.inspectExecutable(ctx, path, scanTime) }) {
+					break
+				}
+				files[path] = file
+			}
+
+			var reasons []string
+			var indicator string
+			if ioc, matched := s.threatIntel.MatchPath(path); matched {
+				reasons = append(reasons, FindingPathIndicator)
+				indicator = ioc.Pattern
+			}
+			if file.hashed && s.threatIntel.IsMaliciousHash(file.md5, file.sha256) {
+				reasons = append(reasons, FindingMaliciousHash)
+			}
+			if file.unsigned {
+				reasons = append(reasons, FindingUnsigned)
+				if host != nil && !host.unsigned {
+					reasons = append(reasons, FindingUnsignedInSigned)
+				}
+			}
+			ref := ProcessRef{PID: p.PID, Name: p.Name, ExePath: p.ExePath, GUID: p.GUID}
+			if len(reasons) == 0 {
+				if _, pending := loadedBy[path]; file.hashed && (!seen || pending) {
+					if !pending {
+						unknown[file.sha256] = append(unknown[file.sha256], path)
+					}
+					loadedBy[path] = append(loadedBy[path], ref)
+				}
+				continue
+			}
+
+			finding, ok := findings[path]
+			if !ok {
+				finding = newModuleFinding(path, file, indicator)
+				findings[path] = finding
+				order = append(order, path)
+			}
+			for _, reason := range reasons {
+				if !slices.Contains(finding.Findings, reason) {
+					finding.Findings = append(finding.Findings, reason)
+				}
+			}
+			finding.Processes = append(finding.Processes, ref)
+		}
+	}
+
+	hashes := make([]string, 0, len(unknown))
+	for hash := range unknown {
+		hashes = append(hashes, hash)
+	}
+	for hash, verdict := range s.lookupReputation(ctx, hashes) {
+		if !verdict.Malicious {
+			continue
+		}
+		for _, path := range unknown[hash] {
+			finding := newModuleFinding(path, files[path], "reputation:"+hash)
+			finding.Findings = []string{FindingMaliciousHash}
+			finding.Processes = loadedBy[path]
+			findings[path] = finding
+			order = append(order, path)
+		}
+	}
+
+	result := make([]ModuleFinding, 0, len(order))
+	for _, path := range order {
+		result = append(result, *findings[path])
+	}
+	logger.LogInfo(logPrefix, fmt.Sprintf("Module scan finished - %d findings", len(result)), "", nil)
+	return result
+}
+
+func newModuleFinding(path string, file *exeFile, indicator string) *ModuleFinding {
+	finding := &ModuleFinding{
+		Path:      path,
+		MD5:       file.md5,
+		SHA256:    file.sha256,
+		Size:      file.size,
+		Indicator: indicator,
+	}
+	if file.signer != "" {
+		signer := file.signer
+		finding.Signer = &signer
+	}
+	return finding
+}
+
+func (s *Scanner) modulesEnabled() bool {
+	return s.config.Modules != nil && s.config.Modules.Enabled
+}
+
+func (s *Scanner) moduleExclusions() []string {
+	if s.config.Modules == nil {
+		return nil
+	}
+	return s.config.Modules.Exclude
+}
+
+// GetModuleFindings returns the suspicious modules found by the last process scan.
+func (s *Scanner) GetModuleFindings() []ModuleFinding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.moduleFindingsCache
+}
@@ -0,0 +1,37 @@
+package agentScanner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// listModules returns the files mapped executable into a process, read
+// from /proc/<pid>/maps.
+func listModules(pid int32) ([]string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory maps: %w", err)
+	}
+	defer f.Close()
+
+	var modules []string
+	seen := make(map[string]bool)
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		// address perms offset dev inode pathname
+		fields := strings.SplitN(lines.Text(), " ", 6)
+		if len(fields) < 6 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		path := strings.TrimSpace(fields[5])
+		// Deleted files and memory files are reported by the image check.
+		if !strings.HasPrefix(path, "/") || isDeletedPath(path) || seen[path] {
+			continue
+		}
+		seen[path] = true
+		modules = append(modules, path)
+	}
+	return modules, lines.Err()
+}
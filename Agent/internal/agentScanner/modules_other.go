@@ -0,0 +1,10 @@
+//go:build !windows && !linux
+
+package agentScanner
+
+import "errors"
+
+// listModules is not implemented on this platform.
+func listModules(pid int32) ([]string, error) {
+	return nil, errors.New("module listing is not supported on this platform")
+}
@@ -0,0 +1,30 @@
+package agentScanner
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// listModules returns the DLLs loaded by a process, including 32-bit
+// modules of WOW64 processes.
+func listModules(pid int32) ([]string, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPMODULE|windows.TH32CS_SNAPMODULE32, uint32(pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot modules: %w", err)
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entry windows.ModuleEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+
+	var modules []string
+	for err = windows.Module32First(snapshot, &entry); err == nil; err = windows.Module32Next(snapshot, &entry) {
+		modules = append(modules, windows.UTF16ToString(entry.ExePath[:]))
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return modules, fmt.Errorf("failed to enumerate modules: %w", err)
+	}
+	return modules, nil
+}
@@ -0,0 +1,75 @@
+package agentScanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+type ConnectionInfo struct {
+	PID        int32  `json:"pid"`
+	Protocol   string `json:"protocol"`
+	LocalAddr  string `json:"localAddr"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+// scanNetwork is the network stage: it records the TCP and UDP sockets open
+// on the host together with their owning process.
+func (s *Scanner) scanNetwork(ctx context.Context) {
+	logPrefix := "agentScanner.scanNetwork"
+	defer s.governor.ObserveScan(models.StageNetwork, time.Now())
+
+	conns, err := psnet.ConnectionsWithContext(ctx, "inet")
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to get network connections", "", err)
+		return
+	}
+
+	connections := make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		info := ConnectionInfo{
+			PID:       c.Pid,
+			Protocol:  socketProtocol(c.Type),
+			LocalAddr: net.JoinHostPort(c.Laddr.IP, strconv.Itoa(int(c.Laddr.Port))),
+			Status:    c.Status,
+		}
+		if c.Raddr.IP != "" {
+			info.RemoteAddr = net.JoinHostPort(c.Raddr.IP, strconv.Itoa(int(c.Raddr.Port)))
+		}
+		connections = append(connections, info)
+	}
+
+	logger.LogInfo(logPrefix, fmt.Sprintf("Length of the Connections - %d", len(connections)), "", nil)
+
+	s.mu.Lock()
+	s.connectionsCache = connections
+	s.mu.Unlock()
+
+	storeItems(s, scanstore.KindSnapshot, SnapshotConnection, connections, time.Now())
+	s.trackChanges(ChangeListener, keyed(listeners(connections), listenerKey))
+}
+
+func socketProtocol(sockType uint32) string {
+	switch sockType {
+	case 1:
+		return "tcp"
+	case 2:
+		return "udp"
+	default:
+		return fmt.Sprintf("type%d", sockType)
+	}
+}
+
+func (s *Scanner) GetConnections() []ConnectionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connectionsCache
+}
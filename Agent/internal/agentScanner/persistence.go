@@ -0,0 +1,312 @@
+package agentScanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// Autostart mechanisms reported in PersistenceEntry.Type.
+const (
+	PersistenceSystemd      = "systemd"
+	PersistenceSystemdUser  = "systemdUser"
+	PersistenceCron         = "cron"
+	PersistenceAnacron      = "anacron"
+	PersistenceRcLocal      = "rcLocal"
+	PersistenceShellProfile = "shellProfile"
+	PersistenceLdPreload    = "ldPreload"
+	PersistenceUdev         = "udev"
+	PersistenceXdgAutostart = "xdgAutostart"
+)
+
+// FindingNewPersistence marks an autostart entry that is not in the baseline.
+const FindingNewPersistence = "newPersistence"
+
+// PersistenceEntry is one autostart entry and the executable it starts.
+// Location is the file the entry was read from. For entries that are a file
+// in their own right, such as shell profiles, ExePath is that file.
+type PersistenceEntry struct {
+	Type      string   `json:"type"`
+	Location  string   `json:"location"`
+	User      string   `json:"user,omitempty"`
+	Command   string   `json:"command,omitempty"`
+	ExePath   string   `json:"exePath,omitempty"`
+	MD5       string   `json:"md5,omitempty"`
+	SHA256    string   `json:"sha256,omitempty"`
+	Size      int64    `json:"size,omitempty"`
+	Signer    *string  `json:"signer,omitempty"`
+	Findings  []string `json:"findings,omitempty"`
+	Indicator string   `json:"indicator,omitempty"`
+	Added     bool     `json:"added"`
+}
+
+// key identifies an entry in the baseline. Entries that are a file of their
+// own include its hash, so appending to a profile counts as a new entry.
+func (e PersistenceEntry) key() string {
+	parts := []string{e.Type, e.Location, e.Command}
+	if e.ExePath == e.Location {
+		parts = append(parts, e.SHA256)
+	}
+	return strings.Join(parts, "|")
+}
+
+// scanPersistence is the persistence stage: it inventories the autostart
+// locations, checks what they start and flags entries added since the
+// baseline was taken.
+func (s *Scanner) scanPersistence(ctx context.Context) {
+	logPrefix := "agentScanner.scanPersistence"
+	defer s.governor.ObserveScan(models.StagePersistence, time.Now())
+
+	entries, err := listPersistence(ctx)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to list autostart entries", "", err)
+		return
+	}
+
+	exclude := s.persistenceExclusions()
+	files := make(map[string]*exeFile)
+	result := make([]PersistenceEntry, 0, len(entries))
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if isExcluded(entry.Location, exclude) || (entry.ExePath != "" && isExcluded(entry.ExePath, exclude)) {
+			continue
+		}
+		s.checkPersistenceEntry(ctx, &entry, files)
+		result = append(result, entry)
+	}
+
+	added := s.persistBaseline.compare(result, time.Now())
+	logger.LogInfo(logPrefix, fmt.Sprintf("Persistence scan finished - %d entries, %d added since the baseline", len(result), added), "", nil)
+
+	s.mu.Lock()
+	s.persistenceCache = result
+	s.mu.Unlock()
+
+	s.trackChanges(ChangePersistence, keyed(result, PersistenceEntry.key))
+}
+
+// checkPersistenceEntry runs the path indicator, hash and signature checks
+// on the entry and the executable it starts.
+func (s *Scanner) checkPersistenceEntry(ctx context.Context, entry *PersistenceEntry, files map[string]*exeFile) {
+	for _, path := range []string{entry.ExePath, entry.Location} {
+		if path == "" {
+			continue
+		}
+		if ioc, matched := s.threatIntel.MatchPath(path); matched {
+			entry.Findings = append(entry.Findings, FindingPathIndicator)
+			entry.Indicator = ioc.Pattern
+			break
+		}
+	}
+
+	if entry.ExePath == "" {
+		return
+	}
+	file, seen := files[entry.ExePath]
+	if !seen {
+		if info, err := os.Stat(entry.ExePath); err == nil && info.Mode().IsRegular() {
+			s.governed(ctx, func() { file = s.inspectFile(ctx, entry.ExePath) })
+		}
+		files[entry.ExePath] = file
+	}
+	if file == nil {
+		return
+	}
+
+	entry.MD5, entry.SHA256, entry.Size = file.md5, file.sha256, file.size
+	if file.signer != "" {
+		signer := file.signer
+		entry.Signer = &signer
+	}
+	if file.hashed && s.threatIntel.IsMaliciousHash(file.md5, file.sha256) {
+		entry.Findings = append(entry.Findings, FindingMaliciousHash)
+	}
+	if file.unsigned {
+		entry.Findings = append(entry.Findings, FindingUnsigned)
+	}
+}
+
+func (s *Scanner) persistenceEnabled() bool {
+	return s.config.Persistence != nil && s.config.Persistence.Enabled
+}
+
+func (s *Scanner) persistenceExclusions() []string {
+	if s.config.Persistence == nil {
+		return nil
+	}
+	return s.config.Persistence.Exclude
+}
+
+// GetPersistence returns the autostart entries found by the last persistence scan.
+func (s *Scanner) GetPersistence() []PersistenceEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.persistenceCache
+}
+
+// ResetPersistenceBaseline accepts the current autostart entries as the new
+// baseline and returns how many it holds.
+func (s *Scanner) ResetPersistenceBaseline() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Readers may still hold the old slice, so it is copied rather than edited.
+	entries := make([]PersistenceEntry, len(s.persistenceCache))
+	for i, entry := range s.persistenceCache {
+		entry.Added = false
+		entry.Findings = removeFinding(entry.Findings, FindingNewPersistence)
+		entries[i] = entry
+	}
+	if err := s.persistBaseline.reset(entries, time.Now()); err != nil {
+		return 0, err
+	}
+	s.persistenceCache = entries
+	return len(entries), nil
+}
+
+func removeFinding(findings []string, finding string) []string {
+	var kept []string
+	for _, f := range findings {
+		if f != finding {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// persistenceBaseline is the set of autostart entries known to be good. It
+// is taken on the first persistence scan and kept in a file so additions
+// are still reported after the agent restarts.
+type persistenceBaseline struct {
+	path    string
+	loaded  bool
+	created time.Time
+	entries map[string]bool
+	mu      sync.Mutex
+}
+
+type persistenceBaselineFile struct {
+	Created time.Time `json:"created"`
+	Entries []string  `json:"entries"`
+}
+
+func newPersistenceBaseline(cfg *models.MonitorConfig) *persistenceBaseline {
+	b := &persistenceBaseline{}
+	if cfg.Persistence != nil {
+		b.path = cfg.Persistence.BaselinePath
+	}
+	return b
+}
+
+// compare flags the entries missing from the baseline and returns how many
+// there are. Without a baseline, the entries become the baseline.
+func (b *persistenceBaseline) compare(entries []PersistenceEntry, now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.loaded {
+		b.loaded = true
+		if err := b.load(); err != nil {
+			logger.LogError("agentScanner.persistenceBaseline", "Failed to load persistence baseline, taking a new one", b.path, err)
+		}
+	}
+	if b.entries == nil {
+		if err := b.replace(entries, now); err != nil {
+			logger.LogError("agentScanner.persistenceBaseline", "Failed to save persistence baseline", b.path, err)
+		}
+		return 0
+	}
+
+	added := 0
+	for i := range entries {
+		if !b.entries[entries[i].key()] {
+			entries[i].Added = true
+			entries[i].Findings = append(entries[i].Findings, FindingNewPersistence)
+			added++
+		}
+	}
+	return added
+}
+
+func (b *persistenceBaseline) reset(entries []PersistenceEntry, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.loaded = true
+	return b.replace(entries, now)
+}
+
+// replace sets the baseline to entries and saves it. Callers hold mu.
+func (b *persistenceBaseline) replace(entries []PersistenceEntry, now time.Time) error {
+	b.created = now
+	b.entries = make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		b.entries[entry.key()] = true
+	}
+	logger.LogInfo("agentScanner.persistenceBaseline", fmt.Sprintf("Took persistence baseline of %d entries", len(b.entries)), b.path, nil)
+	return b.save()
+}
+
+func (b *persistenceBaseline) load() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var file persistenceBaselineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to unmarshal baseline: %w", err)
+	}
+	b.created = file.Created
+	b.entries = make(map[string]bool, len(file.Entries))
+	for _, key := range file.Entries {
+		b.entries[key] = true
+	}
+	return nil
+}
+
+func (b *persistenceBaseline) save() error {
+	if b.path == "" {
+		return nil
+	}
+	file := persistenceBaselineFile{Created: b.created, Entries: make([]string, 0, len(b.entries))}
+	for key := range b.entries {
+		file.Entries = append(file.Entries, key)
+	}
+	slices.Sort(file.Entries)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+	return writeFileAtomic(b.path, data)
+}
+
+// writeFileAtomic writes through a temporary file so a crash never leaves
+// the file half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
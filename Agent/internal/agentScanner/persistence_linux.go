@@ -0,0 +1,469 @@
+package agentScanner
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const persistenceSupported = true
+
+var (
+	systemdDirs = []string{
+		"/etc/systemd/system",
+		"/run/systemd/system",
+		"/usr/local/lib/systemd/system",
+		"/usr/lib/systemd/system",
+		"/lib/systemd/system",
+	}
+	systemdUserDirs = []string{
+		"/etc/systemd/user",
+		"/usr/local/lib/systemd/user",
+		"/usr/lib/systemd/user",
+	}
+	cronScriptDirs  = []string{"/etc/cron.hourly", "/etc/cron.daily", "/etc/cron.weekly", "/etc/cron.monthly"}
+	userCrontabDirs = []string{"/var/spool/cron/crontabs", "/var/spool/cron"}
+	rcLocalFiles    = []string{"/etc/rc.local", "/etc/rc.d/rc.local"}
+	systemProfiles  = []string{
+		"/etc/profile",
+		"/etc/bash.bashrc",
+		"/etc/bashrc",
+		"/etc/environment",
+		"/etc/zsh/zshenv",
+		"/etc/zsh/zprofile",
+		"/etc/zsh/zshrc",
+		"/etc/zshrc",
+	}
+	userProfiles = []string{".profile", ".bashrc", ".bash_profile", ".bash_login", ".bash_logout", ".zshenv", ".zprofile", ".zshrc", ".zlogin"}
+	udevDirs     = []string{"/etc/udev/rules.d", "/run/udev/rules.d", "/usr/lib/udev/rules.d", "/lib/udev/rules.d"}
+	binDirs      = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+
+	// Keys of systemd units that run a command.
+	systemdExecKeys = []string{"ExecStart", "ExecStartPre", "ExecStartPost", "ExecStop", "ExecStopPost", "ExecReload", "ExecCondition"}
+	// Commands that run the command given in their arguments.
+	commandWrappers = []string{"env", "nohup", "exec", "nice", "ionice", "setsid", "sudo", "command", "chrt", "taskset"}
+	// Interpreters whose first non-option argument is the script they run.
+	interpreters = []string{"sh", "bash", "dash", "zsh", "ksh", "python", "perl", "ruby", "php", "node"}
+
+	envAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	udevCommand   = regexp.MustCompile(`\b(RUN|PROGRAM|IMPORT\{program\})(\{program\})?\s*\+?=\s*"([^"]*)"`)
+	desktopCode   = regexp.MustCompile(`%[a-zA-Z%]`)
+)
+
+// persistenceCollector gathers entries, reading every file once even when
+// it is reachable through several symlinked directories.
+type persistenceCollector struct {
+	entries []PersistenceEntry
+	seen    map[string]bool
+}
+
+// listPersistence inventories the autostart locations of the host.
+func listPersistence(ctx context.Context) ([]PersistenceEntry, error) {
+	c := &persistenceCollector{seen: make(map[string]bool)}
+	homes := homeDirectories()
+
+	for _, dir := range systemdDirs {
+		c.systemdUnits(dir, PersistenceSystemd, "")
+	}
+	for _, dir := range systemdUserDirs {
+		c.systemdUnits(dir, PersistenceSystemdUser, "")
+	}
+	for user, home := range homes {
+		c.systemdUnits(filepath.Join(home, ".config/systemd/user"), PersistenceSystemdUser, user)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	c.crontab("/etc/crontab", "", true)
+	for _, path := range listFiles("/etc/cron.d") {
+		c.crontab(path, "", true)
+	}
+	for _, dir := range userCrontabDirs {
+		for _, path := range listFiles(dir) {
+			c.crontab(path, filepath.Base(path), false)
+		}
+	}
+	for _, dir := range cronScriptDirs {
+		for _, path := range listFiles(dir) {
+			c.file(PersistenceCron, path, "root")
+		}
+	}
+	c.anacrontab("/etc/anacrontab")
+
+	for _, path := range rcLocalFiles {
+		c.rcLocal(path)
+	}
+
+	for _, path := range slices.Concat(systemProfiles, listFiles("/etc/profile.d")) {
+		c.file(PersistenceShellProfile, path, "")
+	}
+	for user, home := range homes {
+		for _, name := range userProfiles {
+			c.file(PersistenceShellProfile, filepath.Join(home, name), user)
+		}
+	}
+
+	c.ldPreload("/etc/ld.so.preload")
+
+	for _, dir := range udevDirs {
+		for _, path := range listFiles(dir) {
+			if strings.HasSuffix(path, ".rules") {
+				c.udevRules(path)
+			}
+		}
+	}
+
+	for _, path := range listFiles("/etc/xdg/autostart") {
+		c.desktopEntry(path, "")
+	}
+	for user, home := range homes {
+		for _, path := range listFiles(filepath.Join(home, ".config/autostart")) {
+			c.desktopEntry(path, user)
+		}
+	}
+
+	return c.entries, ctx.Err()
+}
+
+func (c *persistenceCollector) add(entryType, location, user, command string) {
+	c.entries = append(c.entries, PersistenceEntry{
+		Type:     entryType,
+		Location: location,
+		User:     user,
+		Command:  command,
+		ExePath:  commandExecutable(command),
+	})
+}
+
+// open reads a file's lines, or returns nil if it is missing or was already
+// read through another path.
+func (c *persistenceCollector) open(path string) []string {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil || c.seen[real] {
+		return nil
+	}
+	c.seen[real] = true
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// file adds a file that is run or sourced as a whole.
+func (c *persistenceCollector) file(entryType, path, user string) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil || c.seen[real] {
+		return
+	}
+	if info, err := os.Stat(real); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	c.seen[real] = true
+	c.entries = append(c.entries, PersistenceEntry{Type: entryType, Location: path, User: user, ExePath: path})
+}
+
+// systemdUnits reads the units in dir, the units linked from its .wants and
+// .requires directories and the drop-ins of its .d directories.
+func (c *persistenceCollector) systemdUnits(dir, entryType, user string) {
+	for _, path := range listFiles(dir) {
+		c.systemdUnit(path, entryType, user)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && (strings.HasSuffix(name, ".wants") || strings.HasSuffix(name, ".requires") || strings.HasSuffix(name, ".d")) {
+			for _, path := range listFiles(filepath.Join(dir, name)) {
+				c.systemdUnit(path, entryType, user)
+			}
+		}
+	}
+}
+
+func (c *persistenceCollector) systemdUnit(path, entryType, user string) {
+	switch filepath.Ext(path) {
+	case ".service", ".socket", ".conf":
+	default:
+		return
+	}
+	for _, line := range c.open(path) {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || !slices.Contains(systemdExecKeys, strings.TrimSpace(key)) {
+			continue
+		}
+		// Prefixes such as "-" (ignore failure) and "+" (full privileges)
+		// are not part of the command.
+		command := strings.TrimLeft(strings.TrimSpace(value), "-@:+!|")
+		if command != "" {
+			c.add(entryType, path, user, command)
+		}
+	}
+}
+
+// crontab reads a crontab. System crontabs carry the user before the command.
+func (c *persistenceCollector) crontab(path, user string, system bool) {
+	for _, line := range c.open(path) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || envAssignment.MatchString(line) {
+			continue
+		}
+		schedule := 5
+		if strings.HasPrefix(line, "@") {
+			schedule = 1
+		}
+		owner := user
+		if system {
+			fields := strings.Fields(line)
+			if len(fields) <= schedule {
+				continue
+			}
+			owner = fields[schedule]
+			schedule++
+		}
+		if command := fieldsAfter(line, schedule); command != "" {
+			c.add(PersistenceCron, path, owner, command)
+		}
+	}
+}
+
+// anacrontab reads /etc/anacrontab: period, delay, job name, command.
+func (c *persistenceCollector) anacrontab(path string) {
+	for _, line := range c.open(path) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || envAssignment.MatchString(line) {
+			continue
+		}
+		if command := fieldsAfter(line, 3); command != "" {
+			c.add(PersistenceAnacron, path, "root", command)
+		}
+	}
+}
+
+func (c *persistenceCollector) rcLocal(path string) {
+	for _, line := range c.open(path) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "exit 0" {
+			continue
+		}
+		c.add(PersistenceRcLocal, path, "root", line)
+	}
+}
+
+// ldPreload reads the libraries preloaded into every dynamically linked process.
+func (c *persistenceCollector) ldPreload(path string) {
+	for _, line := range c.open(path) {
+		line, _, _ = strings.Cut(line, "#")
+		for _, lib := range strings.FieldsFunc(line, func(r rune) bool { return r == ':' || r == ' ' || r == '\t' }) {
+			c.entries = append(c.entries, PersistenceEntry{Type: PersistenceLdPreload, Location: path, Command: lib, ExePath: lib})
+		}
+	}
+}
+
+// udevRules reads the programs run by udev rules.
+func (c *persistenceCollector) udevRules(path string) {
+	for _, line := range c.open(path) {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, m := range udevCommand.FindAllStringSubmatch(line, -1) {
+			if command := strings.TrimSpace(m[3]); command != "" {
+				c.add(PersistenceUdev, path, "root", command)
+			}
+		}
+	}
+}
+
+// desktopEntry reads the command of an XDG autostart entry. Field codes
+// such as %u are placeholders filled in at launch.
+func (c *persistenceCollector) desktopEntry(path, user string) {
+	if !strings.HasSuffix(path, ".desktop") {
+		return
+	}
+	for _, line := range c.open(path) {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "Exec="); ok {
+			if command := strings.TrimSpace(desktopCode.ReplaceAllString(value, "")); command != "" {
+				c.add(PersistenceXdgAutostart, path, user, command)
+			}
+		}
+	}
+}
+
+// listFiles returns the files directly in dir, skipping editor backups.
+func listFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
+
+// homeDirectories maps users to their home directories from /etc/passwd.
+func homeDirectories() map[string]string {
+	homes := make(map[string]string)
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return homes
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || fields[5] == "" || fields[5] == "/" || seen[fields[5]] {
+			continue
+		}
+		if info, err := os.Stat(fields[5]); err == nil && info.IsDir() {
+			seen[fields[5]] = true
+			homes[fields[0]] = fields[5]
+		}
+	}
+	return homes
+}
+
+// fieldsAfter returns line without its first n whitespace separated fields.
+func fieldsAfter(line string, n int) string {
+	rest := strings.TrimSpace(line)
+	for i := 0; i < n; i++ {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return ""
+		}
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return rest
+}
+
+// commandExecutable resolves the program a command line starts. Wrappers
+// such as env and nohup are looked through, and for shells and script
+// interpreters the script is reported instead of the interpreter.
+func commandExecutable(command string) string {
+	args := splitCommand(command)
+	for len(args) > 0 {
+		name := filepath.Base(args[0])
+		if envAssignment.MatchString(args[0]) {
+			args = args[1:]
+		} else if slices.Contains(commandWrappers, name) {
+			args = args[1:]
+			for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+				args = args[1:]
+			}
+		} else {
+			break
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+
+	exe := lookPath(args[0])
+	if slices.Contains(interpreters, strings.TrimRight(filepath.Base(args[0]), "0123456789.")) {
+		for i := 1; i < len(args); i++ {
+			if args[i] == "-c" {
+				if i+1 < len(args) {
+					if inner := commandExecutable(args[i+1]); inner != "" {
+						return inner
+					}
+				}
+				break
+			}
+			if strings.HasPrefix(args[i], "-") {
+				continue
+			}
+			if filepath.IsAbs(args[i]) {
+				return args[i]
+			}
+			break
+		}
+	}
+	return exe
+}
+
+// lookPath finds a bare program name in the standard binary directories.
+func lookPath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	for _, dir := range binDirs {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// splitCommand splits a command line into words, honouring quotes and
+// backslash escapes, and stops at the first shell operator.
+func splitCommand(command string) []string {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	flush := func() {
+		if inWord {
+			args = append(args, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t':
+			flush()
+		case strings.ContainsRune(";&|<>", r):
+			flush()
+			return args
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	flush()
+	return args
+}
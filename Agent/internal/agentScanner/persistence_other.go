@@ -0,0 +1,14 @@
+//go:build !linux
+
+package agentScanner
+
+import (
+	"context"
+	"errors"
+)
+
+const persistenceSupported = false
+
+func listPersistence(ctx context.Context) ([]PersistenceEntry, error) {
+	return nil, errors.New("persistence inventory is only supported on Linux")
+}
@@ -0,0 +1,8 @@
+//go:build !windows && !linux
+
+package agentScanner
+
+// readPrivileges is not implemented on this platform.
+func readPrivileges(pid int32) (uid, level string) {
+	return "", ""
+}
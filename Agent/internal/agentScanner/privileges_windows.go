@@ -0,0 +1,64 @@
+package agentScanner
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// readPrivileges returns the SID a process runs as and its integrity level.
+// Protected processes cannot be opened and report neither.
+func readPrivileges(pid int32) (uid, level string) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", ""
+	}
+	defer windows.CloseHandle(h)
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(h, windows.TOKEN_QUERY, &token); err != nil {
+		return "", ""
+	}
+	defer token.Close()
+
+	if user, err := token.GetTokenUser(); err == nil {
+		uid = user.User.Sid.String()
+	}
+	return uid, integrityLevel(token)
+}
+
+// integrityLevel maps the mandatory label RID of a token to its name.
+func integrityLevel(token windows.Token) string {
+	var size uint32
+	windows.GetTokenInformation(token, windows.TokenIntegrityLevel, nil, 0, &size)
+	if size == 0 {
+		return ""
+	}
+	buf := make([]byte, size)
+	if err := windows.GetTokenInformation(token, windows.TokenIntegrityLevel, &buf[0], size, &size); err != nil {
+		return ""
+	}
+
+	sid := (*windows.Tokenmandatorylabel)(unsafe.Pointer(&buf[0])).Label.Sid
+	count := sid.SubAuthorityCount()
+	if count == 0 {
+		return ""
+	}
+
+	switch rid := sid.SubAuthority(uint32(count - 1)); {
+	case rid >= 0x5000:
+		return "protected"
+	case rid >= 0x4000:
+		return "system"
+	case rid >= 0x3000:
+		return "high"
+	case rid >= 0x2100:
+		return "mediumPlus"
+	case rid >= 0x2000:
+		return "medium"
+	case rid >= 0x1000:
+		return "low"
+	default:
+		return "untrusted"
+	}
+}
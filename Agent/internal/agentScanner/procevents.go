@@ -0,0 +1,381 @@
+package agentScanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/rules"
+	"github.com/bhaiFi/security-monitor/internal/signature"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Process event types, also published to subscribers.
+const (
+	EventProcessStart = "processStart"
+	EventProcessExit  = "processExit"
+)
+
+// Reasons reported in ProcessEvent.Findings.
+const (
+	FindingSuspiciousRelationship = "suspiciousRelationship"
+)
+
+// ProcessEvent is a process start or exit seen between scans.
+type ProcessEvent struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	PID        int32     `json:"pid"`
+	PPID       int32     `json:"ppid"`
+	GUID       string    `json:"guid,omitempty"`
+	User       string    `json:"user,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	ParentName string    `json:"parentName,omitempty"`
+	ExePath    string    `json:"exePath,omitempty"`
+	Cmdline    string    `json:"cmdline,omitempty"`
+	MD5        string    `json:"md5,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Findings   []string  `json:"findings,omitempty"`
+	Indicator  string    `json:"indicator,omitempty"`
+	Source     string    `json:"source"`
+
+	Relationships []RelationshipInfo      `json:"relationships,omitempty"`
+	Masquerade    []rules.MasqueradeMatch `json:"masquerade,omitempty"`
+	Anomalies     []AnomalyInfo           `json:"anomalies,omitempty"`
+}
+
+// processEventSource delivers the PIDs of processes that started and exited.
+type processEventSource interface {
+	name() string
+	run(ctx context.Context, started, exited func(pid int32)) error
+}
+
+// eventRing keeps the most recent process events.
+type eventRing struct {
+	events []ProcessEvent
+	next   int
+	full   bool
+	mu     sync.Mutex
+}
+
+func newEventRing(size int) *eventRing {
+	if size <= 0 {
+		size = models.DefaultProcessEventBuffer
+	}
+	return &eventRing{events: make([]ProcessEvent, size)}
+}
+
+func (r *eventRing) add(ev ProcessEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events[r.next] = ev
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the buffered events, oldest first.
+func (r *eventRing) snapshot() []ProcessEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]ProcessEvent(nil), r.events[:r.next]...)
+	}
+	out := make([]ProcessEvent, 0, len(r.events))
+	out = append(out, r.events[r.next:]...)
+	return append(out, r.events[:r.next]...)
+}
+
+// processEventCollector turns raw start/exit notifications into evaluated
+// ProcessEvents. It remembers live processes so exit events carry the same
+// details as the matching start.
+type processEventCollector struct {
+	scanner *Scanner
+	source  string
+	live    map[int32]ProcessEvent
+	mu      sync.Mutex
+
+	// queue decouples the event source, which must keep reading the kernel,
+	// from the slower hash and signature checks.
+	queue chan ProcessEvent
+}
+
+func (s *Scanner) startProcessEvents(ctx context.Context) {
+	logPrefix := "agentScanner.startProcessEvents"
+
+	cfg := s.config.ProcessEvents
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	pollInterval := time.Duration(cfg.PollIntervalMillis) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = models.DefaultProcessPollMillis * time.Millisecond
+	}
+
+	c := &processEventCollector{
+		scanner: s,
+		live:    make(map[int32]ProcessEvent),
+		queue:   make(chan ProcessEvent, models.DefaultProcessEventBuffer),
+	}
+	c.seed(ctx)
+	go c.process(ctx)
+
+	go func() {
+		// The native source is preferred; polling takes over if it is not
+		// available or fails.
+		for _, source := range []processEventSource{newNativeProcessSource(), &pollingProcessSource{interval: pollInterval}} {
+			if source == nil {
+				continue
+			}
+			c.setSource(source.name())
+			logger.LogInfo(logPrefix, "Collecting process events", source.name(), nil)
+
+			err := source.run(ctx, c.started, c.exited)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.LogError(logPrefix, "Process event source stopped, falling back", source.name(), err)
+		}
+	}()
+}
+
+func (c *processEventCollector) setSource(name string) {
+	c.mu.Lock()
+	c.source = name
+	c.mu.Unlock()
+}
+
+// seed records the processes already running so their exits are reported
+// with full details.
+func (c *processEventCollector) seed(ctx context.Context) {
+	nodes, err := c.scanner.procSource.Processes(ctx)
+	if err != nil {
+		logger.LogError("agentScanner.processEvents", "Failed to list processes for seeding", "", err)
+		return
+	}
+	c.scanner.procTable.refresh(nodes, time.Now())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, node := range nodes {
+		c.live[node.PID] = c.describe(node)
+	}
+}
+
+func (c *processEventCollector) started(pid int32) {
+	// Short-lived processes may be gone already, leaving only the PID.
+	node, err := c.scanner.procSource.Process(pid)
+	if err != nil {
+		node = ProcessNode{PID: pid}
+	}
+	c.scanner.procTable.started(node)
+
+	ev := c.describe(node)
+	ev.Type = EventProcessStart
+	ev.Time = time.Now()
+
+	c.mu.Lock()
+	ev.Source = c.source
+	c.live[pid] = ev
+	c.mu.Unlock()
+
+	c.enqueue(ev)
+}
+
+func (c *processEventCollector) exited(pid int32) {
+	c.scanner.procTable.exited(pid, time.Now())
+
+	c.mu.Lock()
+	ev, known := c.live[pid]
+	delete(c.live, pid)
+	source := c.source
+	c.mu.Unlock()
+
+	if !known {
+		ev = ProcessEvent{PID: pid}
+	}
+	ev.Type = EventProcessExit
+	ev.Time = time.Now()
+	ev.Source = source
+	ev.Findings = nil
+	ev.Indicator = ""
+	ev.Relationships = nil
+	ev.Masquerade = nil
+	ev.Anomalies = nil
+
+	c.enqueue(ev)
+}
+
+func (c *processEventCollector) enqueue(ev ProcessEvent) {
+	select {
+	case c.queue <- ev:
+	default:
+		logger.LogWarning("agentScanner.processEvents", "Event queue full, process event dropped", ev.PID)
+	}
+}
+
+// process evaluates queued events in order and makes them available to the
+// ring buffer and subscribers.
+func (c *processEventCollector) process(ctx context.Context) {
+	for {
+		select {
+		case ev := <-c.queue:
+			if ev.Type == EventProcessStart {
+				c.scanner.evaluateProcessEvent(ctx, &ev)
+			}
+			c.scanner.procEvents.add(ev)
+			c.scanner.events.publish(ev.Type, ev)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// describe turns a process into an event. The parent is looked up in the
+// process table, which still holds parents that have exited.
+func (c *processEventCollector) describe(node ProcessNode) ProcessEvent {
+	ev := ProcessEvent{
+		PID:     node.PID,
+		PPID:    node.PPID,
+		GUID:    node.GUID,
+		User:    node.User,
+		Name:    node.Name,
+		ExePath: node.ExePath,
+		Cmdline: node.Cmdline,
+	}
+	if parent, ok := c.scanner.procTable.parentOf(node); ok {
+		ev.ParentName = parent.Name
+	}
+	return ev
+}
+
+// evaluateProcessEvent runs the relationship, hash and signature checks on a
+// newly started process. The file checks wait for a governor worker slot.
+func (s *Scanner) evaluateProcessEvent(ctx context.Context, ev *ProcessEvent) {
+	logPrefix := "agentScanner.evaluateProcessEvent"
+
+	if s.relRules != nil && s.relRules.Len() > 0 {
+		child := ProcessNode{PID: ev.PID, PPID: ev.PPID, Name: ev.Name, ExePath: ev.ExePath, Cmdline: ev.Cmdline}
+		if node, ok := s.procTable.get(ev.PID); ok {
+			child = node
+		}
+		nodes := s.procTable.ancestry(child, s.relRules.MaxDepth())
+		chain := ruleChain(nodes)
+		for _, match := range s.relRules.Match(chain, s.cachedSigner()) {
+			ev.Relationships = append(ev.Relationships, newRelationshipInfo(nodes, match))
+		}
+		if len(ev.Relationships) > 0 {
+			ev.Findings = append(ev.Findings, FindingSuspiciousRelationship)
+		}
+	}
+
+	if s.masquerade != nil {
+		node := ProcessNode{PID: ev.PID, PPID: ev.PPID, Name: ev.Name, ExePath: ev.ExePath, Cmdline: ev.Cmdline}
+		if ev.Masquerade, _ = s.checkMasquerade(node); len(ev.Masquerade) > 0 {
+			ev.Findings = append(ev.Findings, FindingMasquerade)
+		}
+	}
+
+	if s.learner != nil {
+		node := ProcessNode{PID: ev.PID, GUID: ev.GUID, Name: ev.Name, ExePath: ev.ExePath, User: ev.User}
+		observation := learnerObservation{node: node, parent: ev.ParentName}
+		if ev.Anomalies = s.reportAnomalies(s.learner.observe([]learnerObservation{observation}, ev.Time)); len(ev.Anomalies) > 0 {
+			ev.Findings = append(ev.Findings, FindingAnomaly)
+		}
+	}
+
+	if ev.ExePath != "" {
+		if ioc, matched := s.threatIntel.MatchPath(ev.ExePath); matched {
+			ev.Findings = append(ev.Findings, FindingPathIndicator)
+			ev.Indicator = ioc.Pattern
+		}
+
+		s.governed(ctx, func() {
+			if hashes, err := s.governor.HashFile(ctx, ev.ExePath); err == nil && !hashes.Partial {
+				ev.MD5, ev.SHA256 = hashes.MD5, hashes.SHA256
+				s.history.record(ev.ExePath, hashes.MD5, hashes.SHA256, ev.Time)
+				if s.threatIntel.IsMaliciousHash(hashes.MD5, hashes.SHA256) {
+					ev.Findings = append(ev.Findings, FindingMaliciousHash)
+				}
+			}
+
+			if isSigned, err := s.sigVerifier.Verify(ev.ExePath); err == nil && !isSigned {
+				ev.Findings = append(ev.Findings, FindingUnsigned)
+			} else if err != nil && !errors.Is(err, signature.ErrUnsupported) {
+				logger.LogError(logPrefix, "Signature verification failed", ev.ExePath, err)
+			}
+		})
+	}
+
+	if len(ev.Findings) > 0 {
+		logger.LogInfo(logPrefix, "[Suspicious] Process started", ev.ExePath, ev)
+	}
+}
+
+// pollingProcessSource diffs the PID list at a short interval. It catches
+// every process that lives longer than the interval.
+type pollingProcessSource struct {
+	interval time.Duration
+}
+
+func (p *pollingProcessSource) name() string {
+	return "poll"
+}
+
+func (p *pollingProcessSource) run(ctx context.Context, started, exited func(pid int32)) error {
+	known, err := currentPids(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			current, err := currentPids(ctx)
+			if err != nil {
+				logger.LogError("agentScanner.pollingProcessSource", "Failed to list PIDs", "", err)
+				continue
+			}
+			for pid := range current {
+				if !known[pid] {
+					started(pid)
+				}
+			}
+			for pid := range known {
+				if !current[pid] {
+					exited(pid)
+				}
+			}
+			known = current
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func currentPids(ctx context.Context) (map[int32]bool, error) {
+	pids, err := process.PidsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[int32]bool, len(pids))
+	for _, pid := range pids {
+		set[pid] = true
+	}
+	return set, nil
+}
+
+// GetProcessEvents returns the recent process start and exit events, oldest first.
+func (s *Scanner) GetProcessEvents() []ProcessEvent {
+	return s.procEvents.snapshot()
+}
@@ -0,0 +1,124 @@
+package agentScanner
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Netlink process connector constants from linux/connector.h and linux/cn_proc.h.
+const (
+	cnIdxProc         = 0x1
+	cnValProc         = 0x1
+	procCnMcastListen = 1
+	procEventExec     = 0x00000002
+	procEventExit     = 0x80000000
+
+	nlmsgHeaderLen = 16
+	cnMsgHeaderLen = 20
+	// proc_event: what, cpu, timestamp_ns, then the event data.
+	procEventHeaderLen = 16
+)
+
+// netlinkProcessSource subscribes to the kernel process connector, which
+// reports every exec and exit however short-lived. It needs CAP_NET_ADMIN.
+type netlinkProcessSource struct{}
+
+func newNativeProcessSource() processEventSource {
+	return &netlinkProcessSource{}
+}
+
+func (n *netlinkProcessSource) name() string {
+	return "netlink"
+}
+
+func (n *netlinkProcessSource) run(ctx context.Context, started, exited func(pid int32)) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+
+	defer unix.Close(fd)
+
+	// A receive timeout lets the loop notice shutdown while no events arrive.
+	timeout := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		return fmt.Errorf("failed to set netlink receive timeout: %w", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		return fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	if err := sendListen(fd); err != nil {
+		return fmt.Errorf("failed to subscribe to process events: %w", err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		nr, _, err := unix.Recvfrom(fd, buf, 0)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == unix.EAGAIN || err == unix.EINTR || err == unix.ENOBUFS {
+			// ENOBUFS means events were dropped under load; keep reading.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read netlink socket: %w", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:nr])
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			handleProcEvent(msg.Data, started, exited)
+		}
+	}
+}
+
+func sendListen(fd int) error {
+	msg := make([]byte, nlmsgHeaderLen+cnMsgHeaderLen+4)
+	le := binary.NativeEndian
+
+	le.PutUint32(msg[0:], uint32(len(msg)))
+	le.PutUint16(msg[4:], unix.NLMSG_DONE)
+	le.PutUint32(msg[12:], uint32(unix.Getpid()))
+
+	cn := msg[nlmsgHeaderLen:]
+	le.PutUint32(cn[0:], cnIdxProc)
+	le.PutUint32(cn[4:], cnValProc)
+	le.PutUint16(cn[16:], 4)
+	le.PutUint32(cn[cnMsgHeaderLen:], procCnMcastListen)
+
+	return unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+}
+
+func handleProcEvent(data []byte, started, exited func(pid int32)) {
+	if len(data) < cnMsgHeaderLen+procEventHeaderLen+8 {
+		return
+	}
+	le := binary.NativeEndian
+
+	ev := data[cnMsgHeaderLen:]
+	what := le.Uint32(ev[0:])
+	body := ev[procEventHeaderLen:]
+
+	// Both exec and exit data start with process_pid and process_tgid. Only
+	// thread group leaders are reported so threads do not look like processes.
+	pid := int32(le.Uint32(body[0:]))
+	tgid := int32(le.Uint32(body[4:]))
+	if pid != tgid {
+		return
+	}
+
+	switch what {
+	case procEventExec:
+		started(tgid)
+	case procEventExit:
+		exited(tgid)
+	}
+}
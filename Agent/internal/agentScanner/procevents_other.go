@@ -0,0 +1,9 @@
+//go:build !linux
+
+package agentScanner
+
+// newNativeProcessSource returns nil where no kernel event source is
+// implemented, leaving process events to the polling source.
+func newNativeProcessSource() processEventSource {
+	return nil
+}
@@ -0,0 +1,259 @@
+package agentScanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessSource lists the processes the scanner works on.
+type ProcessSource interface {
+	// Name identifies the source in logs.
+	Name() string
+	// Processes returns a snapshot of every process.
+	Processes(ctx context.Context) ([]ProcessNode, error)
+	// Process returns a single process by PID.
+	Process(pid int32) (ProcessNode, error)
+}
+
+// ProcessSnapshot is one recorded process listing, as read by the replay source.
+type ProcessSnapshot struct {
+	Time      time.Time     `json:"time"`
+	Processes []ProcessNode `json:"processes"`
+}
+
+// NewProcessSource builds the source configured under monitor.process_source.
+// Relative paths are resolved against directory.
+func NewProcessSource(cfg *models.ProcessSourceConfig, directory string) (ProcessSource, error) {
+	if cfg == nil {
+		return NewDefaultProcessSource(), nil
+	}
+
+	var source ProcessSource
+	switch cfg.Type {
+	case "", models.ProcessSourceAuto:
+		source = NewDefaultProcessSource()
+	case models.ProcessSourceProcfs:
+		var err error
+		if source, err = NewProcfsSource(); err != nil {
+			return nil, err
+		}
+	case models.ProcessSourceGopsutil:
+		source = NewGopsutilSource()
+	case models.ProcessSourceReplay:
+		var err error
+		if source, err = NewReplaySource(resolvePath(directory, cfg.ReplayPath)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown process source type: %s", cfg.Type)
+	}
+
+	if cfg.RecordPath != "" {
+		source = NewRecordingSource(source, resolvePath(directory, cfg.RecordPath))
+	}
+	return source, nil
+}
+
+// NewDefaultProcessSource returns the native /proc collector on Linux and
+// the gopsutil source elsewhere.
+func NewDefaultProcessSource() ProcessSource {
+	if procfs, err := NewProcfsSource(); err == nil {
+		return procfs
+	}
+	return NewGopsutilSource()
+}
+
+func resolvePath(directory, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(directory, path)
+}
+
+// GopsutilSource reads processes through gopsutil on any platform.
+type GopsutilSource struct{}
+
+func NewGopsutilSource() *GopsutilSource {
+	return &GopsutilSource{}
+}
+
+func (g *GopsutilSource) Name() string {
+	return models.ProcessSourceGopsutil
+}
+
+func (g *GopsutilSource) Processes(ctx context.Context) ([]ProcessNode, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process list: %w", err)
+	}
+	nodes := make([]ProcessNode, 0, len(procs))
+	for _, p := range procs {
+		nodes = append(nodes, nodeFromProcess(p))
+	}
+	return nodes, nil
+}
+
+func (g *GopsutilSource) Process(pid int32) (ProcessNode, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return ProcessNode{}, err
+	}
+	return nodeFromProcess(p), nil
+}
+
+// nodeFromProcess reads what is still readable about a process. Short-lived
+// processes may be gone already, leaving only some fields set.
+func nodeFromProcess(p *process.Process) ProcessNode {
+	node := ProcessNode{PID: p.Pid}
+	node.Name, _ = p.Name()
+	node.ExePath, _ = p.Exe()
+	node.PPID, _ = p.Ppid()
+	node.Cmdline, _ = p.Cmdline()
+	node.User, _ = p.Username()
+	node.Cwd, _ = p.Cwd()
+	node.UID, node.IntegrityLevel = readPrivileges(p.Pid)
+	if created, err := p.CreateTime(); err == nil {
+		node.StartTime = time.UnixMilli(created)
+	}
+	node.GUID = processGUID(node.PID, node.StartTime)
+	return node
+}
+
+// ReplaySource plays back recorded snapshots, one per call to Processes,
+// and keeps returning the last one once they run out. The file holds one
+// JSON ProcessSnapshot per line, as written by RecordingSource. Scans of a
+// replayed snapshot take executable hashes and signers from it rather than
+// reading the files.
+type ReplaySource struct {
+	path      string
+	snapshots []ProcessSnapshot
+	next      int
+	current   map[int32]ProcessNode
+	mu        sync.Mutex
+}
+
+func NewReplaySource(path string) (*ReplaySource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay file: %w", err)
+	}
+	defer f.Close()
+
+	r := &ReplaySource{path: path}
+	lines := bufio.NewScanner(f)
+	lines.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for lines.Scan() {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		var snapshot ProcessSnapshot
+		if err := json.Unmarshal(lines.Bytes(), &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal snapshot %d: %w", len(r.snapshots)+1, err)
+		}
+		for i, node := range snapshot.Processes {
+			if node.GUID == "" {
+				snapshot.Processes[i].GUID = processGUID(node.PID, node.StartTime)
+			}
+		}
+		r.snapshots = append(r.snapshots, snapshot)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read replay file: %w", err)
+	}
+	if len(r.snapshots) == 0 {
+		return nil, fmt.Errorf("replay file %s holds no snapshots", path)
+	}
+
+	r.setCurrent(r.snapshots[0])
+	logger.LogInfo("agentScanner.ReplaySource", fmt.Sprintf("Loaded %d process snapshots", len(r.snapshots)), path, nil)
+	return r, nil
+}
+
+func (r *ReplaySource) Name() string {
+	return models.ProcessSourceReplay
+}
+
+func (r *ReplaySource) Processes(ctx context.Context) ([]ProcessNode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.snapshots[min(r.next, len(r.snapshots)-1)]
+	if r.next < len(r.snapshots) {
+		r.next++
+	}
+	r.setCurrent(snapshot)
+	return append([]ProcessNode(nil), snapshot.Processes...), nil
+}
+
+// Process looks the PID up in the snapshot returned last.
+func (r *ReplaySource) Process(pid int32) (ProcessNode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	node, ok := r.current[pid]
+	if !ok {
+		return ProcessNode{}, fmt.Errorf("process %d not in replayed snapshot", pid)
+	}
+	return node, nil
+}
+
+func (r *ReplaySource) setCurrent(snapshot ProcessSnapshot) {
+	r.current = make(map[int32]ProcessNode, len(snapshot.Processes))
+	for _, node := range snapshot.Processes {
+		r.current[node.PID] = node
+	}
+}
+
+// RecordingSource appends every snapshot taken from another source to a
+// file that ReplaySource can play back.
+type RecordingSource struct {
+	ProcessSource
+	path string
+	mu   sync.Mutex
+}
+
+func NewRecordingSource(source ProcessSource, path string) *RecordingSource {
+	return &RecordingSource{ProcessSource: source, path: path}
+}
+
+func (r *RecordingSource) Processes(ctx context.Context) ([]ProcessNode, error) {
+	nodes, err := r.ProcessSource.Processes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.record(ProcessSnapshot{Time: time.Now(), Processes: nodes}); err != nil {
+		logger.LogError("agentScanner.RecordingSource", "Failed to record process snapshot", r.path, err)
+	}
+	return nodes, nil
+}
+
+func (r *RecordingSource) record(snapshot ProcessSnapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open record file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
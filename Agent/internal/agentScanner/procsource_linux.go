@@ -0,0 +1,202 @@
+package agentScanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// clockTicks is USER_HZ, the unit of the start time in /proc/[pid]/stat. It
+// is 100 on every supported architecture.
+const clockTicks = 100
+
+// commLen is the length the kernel truncates process names to.
+const commLen = 15
+
+// ProcfsSource reads processes straight from /proc.
+type ProcfsSource struct {
+	root     string
+	bootTime time.Time
+
+	users   map[string]string
+	usersMu sync.Mutex
+}
+
+func NewProcfsSource() (ProcessSource, error) {
+	p := &ProcfsSource{root: "/proc", users: make(map[string]string)}
+	bootTime, err := p.readBootTime()
+	if err != nil {
+		return nil, err
+	}
+	p.bootTime = bootTime
+	return p, nil
+}
+
+func (p *ProcfsSource) Name() string {
+	return models.ProcessSourceProcfs
+}
+
+func (p *ProcfsSource) Processes(ctx context.Context) ([]ProcessNode, error) {
+	entries, err := os.ReadDir(p.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p.root, err)
+	}
+
+	nodes := make([]ProcessNode, 0, len(entries))
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		pid, err := strconv.ParseInt(entry.Name(), 10, 32)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// Processes that exit while the directory is read are skipped.
+		if node, err := p.Process(int32(pid)); err == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (p *ProcfsSource) Process(pid int32) (ProcessNode, error) {
+	dir := filepath.Join(p.root, strconv.Itoa(int(pid)))
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return ProcessNode{}, fmt.Errorf("failed to read process %d: %w", pid, err)
+	}
+	node, err := p.parseStat(pid, stat)
+	if err != nil {
+		return ProcessNode{}, err
+	}
+
+	// The executable link is unreadable for kernel threads and for other
+	// users' processes when not running as root.
+	node.ExePath, _ = os.Readlink(filepath.Join(dir, "exe"))
+	if len(node.Name) == commLen && strings.HasPrefix(filepath.Base(node.ExePath), node.Name) {
+		node.Name = filepath.Base(node.ExePath)
+	}
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		node.Cmdline = strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	}
+	node.Cwd, _ = os.Readlink(filepath.Join(dir, "cwd"))
+	if uid, level, err := readProcStatus(filepath.Join(dir, "status")); err == nil {
+		node.UID, node.IntegrityLevel = uid, level
+		node.User = p.lookupUser(uid)
+	}
+	node.GUID = processGUID(node.PID, node.StartTime)
+	return node, nil
+}
+
+// parseStat reads the name, parent and start time from /proc/[pid]/stat.
+// The name is in parentheses and may itself contain spaces and parentheses.
+func (p *ProcfsSource) parseStat(pid int32, stat []byte) (ProcessNode, error) {
+	open := bytes.IndexByte(stat, '(')
+	end := bytes.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return ProcessNode{}, fmt.Errorf("malformed stat for process %d", pid)
+	}
+
+	// Fields after the name, starting with state (field 3 in proc(5)).
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return ProcessNode{}, fmt.Errorf("short stat for process %d", pid)
+	}
+
+	node := ProcessNode{PID: pid, Name: string(stat[open+1 : end])}
+	if ppid, err := strconv.ParseInt(fields[1], 10, 32); err == nil {
+		node.PPID = int32(ppid)
+	}
+	if ticks, err := strconv.ParseUint(fields[19], 10, 64); err == nil {
+		node.StartTime = p.bootTime.Add(time.Duration(ticks) * time.Second / clockTicks)
+	}
+	return node, nil
+}
+
+func (p *ProcfsSource) readBootTime() (time.Time, error) {
+	f, err := os.Open(filepath.Join(p.root, "stat"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read boot time: %w", err)
+	}
+	defer f.Close()
+
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		if value, ok := strings.CutPrefix(lines.Text(), "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse boot time: %w", err)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("boot time not found in %s/stat", p.root)
+}
+
+// readProcStatus returns the real UID from /proc/[pid]/status and the
+// privilege level: "root" when running with effective UID 0, "capabilities"
+// when holding effective capabilities, otherwise "user".
+func readProcStatus(path string) (uid, level string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	var euid, capEff string
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "Uid:"); ok {
+			if fields := strings.Fields(value); len(fields) > 1 {
+				uid, euid = fields[0], fields[1]
+			}
+		} else if value, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			capEff = strings.TrimSpace(value)
+		}
+	}
+	if uid == "" {
+		return "", "", fmt.Errorf("no Uid line in %s", path)
+	}
+
+	switch {
+	case euid == "0":
+		level = "root"
+	case strings.Trim(capEff, "0") != "":
+		level = "capabilities"
+	default:
+		level = "user"
+	}
+	return uid, level, nil
+}
+
+// readPrivileges returns the real UID and privilege level of a process.
+func readPrivileges(pid int32) (uid, level string) {
+	uid, level, _ = readProcStatus(filepath.Join("/proc", strconv.Itoa(int(pid)), "status"))
+	return uid, level
+}
+
+// lookupUser resolves a UID to a user name, falling back to the UID itself.
+func (p *ProcfsSource) lookupUser(uid string) string {
+	p.usersMu.Lock()
+	defer p.usersMu.Unlock()
+
+	if name, ok := p.users[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	p.users[uid] = name
+	return name
+}
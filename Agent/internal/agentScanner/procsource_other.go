@@ -0,0 +1,10 @@
+//go:build !linux
+
+package agentScanner
+
+import "errors"
+
+// NewProcfsSource fails outside Linux, which has no /proc to read.
+func NewProcfsSource() (ProcessSource, error) {
+	return nil, errors.New("the /proc process source is only available on Linux")
+}
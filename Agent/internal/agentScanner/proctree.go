@@ -0,0 +1,322 @@
+package agentScanner
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/rules"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// ProcessNode is a process in the process tree. Exited processes are kept
+// for a grace period with ExitTime set, so the chains through them stay intact.
+// MD5, SHA256 and Signer are only set in replayed snapshots, which describe
+// executables that are not on this host.
+type ProcessNode struct {
+	PID            int32          `json:"pid"`
+	PPID           int32          `json:"ppid"`
+	GUID           string         `json:"guid"`
+	Name           string         `json:"name"`
+	ExePath        string         `json:"exePath,omitempty"`
+	Cmdline        string         `json:"cmdline,omitempty"`
+	User           string         `json:"user,omitempty"`
+	UID            string         `json:"uid,omitempty"`
+	Cwd            string         `json:"cwd,omitempty"`
+	IntegrityLevel string         `json:"integrityLevel,omitempty"`
+	StartTime      time.Time      `json:"startTime"`
+	ExitTime       *time.Time     `json:"exitTime,omitempty"`
+	MD5            string         `json:"md5,omitempty"`
+	SHA256         string         `json:"sha256,omitempty"`
+	Signer         string         `json:"signer,omitempty"`
+	Children       []*ProcessNode `json:"children,omitempty"`
+}
+
+func (n ProcessNode) ruleProcess() rules.Process {
+	return rules.Process{PID: n.PID, Name: n.Name, ExePath: n.ExePath, Cmdline: n.Cmdline}
+}
+
+// isParentOf reports whether n is the parent of child rather than a later
+// process that reused the parent's PID or an earlier one that had exited.
+func (n ProcessNode) isParentOf(child ProcessNode) bool {
+	if n.PID != child.PPID || n.PID == child.PID {
+		return false
+	}
+	if n.StartTime.IsZero() || child.StartTime.IsZero() {
+		return true
+	}
+	if n.ExitTime != nil && n.ExitTime.Before(child.StartTime) {
+		return false
+	}
+	return !n.StartTime.After(child.StartTime)
+}
+
+// sameProcess reports whether n and other are the same process rather than
+// two that held the same PID.
+func (n ProcessNode) sameProcess(other ProcessNode) bool {
+	return n.PID == other.PID && n.StartTime.Equal(other.StartTime)
+}
+
+// exitedKey identifies an exited process, whose PID may have been reused.
+type exitedKey struct {
+	pid   int32
+	start int64
+}
+
+// processTable tracks running processes and remembers exited ones for a
+// grace period. It is refreshed by every process scan and kept current
+// between scans by the process event collector. A process keeps the parent
+// it was first seen with, so chains survive the reparenting of children
+// whose parent exited.
+type processTable struct {
+	live   map[int32]ProcessNode
+	gone   map[exitedKey]ProcessNode
+	grace  time.Duration
+	lookup func(pid int32) (ProcessNode, error)
+	mu     sync.RWMutex
+}
+
+func newProcessTable(cfg *models.MonitorConfig, lookup func(pid int32) (ProcessNode, error)) *processTable {
+	grace := models.DefaultExitGraceSeconds * time.Second
+	if cfg.ProcessEvents != nil && cfg.ProcessEvents.ExitGraceSeconds > 0 {
+		grace = time.Duration(cfg.ProcessEvents.ExitGraceSeconds) * time.Second
+	}
+	return &processTable{
+		live:   make(map[int32]ProcessNode),
+		gone:   make(map[exitedKey]ProcessNode),
+		grace:  grace,
+		lookup: lookup,
+	}
+}
+
+// refresh replaces the running processes with a full snapshot. Processes
+// missing from it are marked as exited. Processes already tracked keep
+// their first parent, which is also written back to nodes.
+func (t *processTable) refresh(nodes []ProcessNode, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := nodeMap(nodes)
+	for pid, node := range t.live {
+		if current, running := snapshot[pid]; !running || !current.sameProcess(node) {
+			t.exit(node, now)
+		}
+	}
+	for i := range nodes {
+		t.track(&nodes[i])
+	}
+	t.prune(now)
+}
+
+func (t *processTable) started(node ProcessNode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A new process moves any earlier one that held the PID to the exited.
+	if old, ok := t.live[node.PID]; ok && !old.sameProcess(node) {
+		t.exit(old, time.Now())
+	}
+	t.track(&node)
+	t.prune(time.Now())
+}
+
+func (t *processTable) exited(pid int32, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if node, ok := t.live[pid]; ok {
+		t.exit(node, at)
+	}
+}
+
+// track records a running process, keeping the parent it was first seen
+// with. Callers hold mu.
+func (t *processTable) track(node *ProcessNode) {
+	if old, ok := t.live[node.PID]; ok && old.sameProcess(*node) && old.PPID != 0 {
+		node.PPID = old.PPID
+	}
+	tracked := *node
+	tracked.Children = nil
+	t.live[node.PID] = tracked
+}
+
+// exit moves a running process to the exited ones. Callers hold mu.
+func (t *processTable) exit(node ProcessNode, at time.Time) {
+	delete(t.live, node.PID)
+	node.ExitTime = &at
+	t.gone[exitedKey{pid: node.PID, start: node.StartTime.UnixNano()}] = node
+}
+
+// prune drops exited processes past the grace period. Callers hold mu.
+func (t *processTable) prune(now time.Time) {
+	for key, node := range t.gone {
+		if now.Sub(*node.ExitTime) > t.grace {
+			delete(t.gone, key)
+		}
+	}
+}
+
+func nodeMap(nodes []ProcessNode) map[int32]ProcessNode {
+	m := make(map[int32]ProcessNode, len(nodes))
+	for _, node := range nodes {
+		m[node.PID] = node
+	}
+	return m
+}
+
+// get returns the process holding pid, or the latest exited one that did.
+func (t *processTable) get(pid int32) (ProcessNode, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if node, ok := t.live[pid]; ok {
+		return node, true
+	}
+	var latest ProcessNode
+	found := false
+	for key, node := range t.gone {
+		if key.pid == pid && (!found || node.StartTime.After(latest.StartTime)) {
+			latest, found = node, true
+		}
+	}
+	return latest, found
+}
+
+// running returns the processes that have not exited.
+func (t *processTable) running() []ProcessNode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	nodes := make([]ProcessNode, 0, len(t.live))
+	for _, node := range t.live {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// trackedParent returns the tracked process that is the parent of node,
+// preferring the running holder of the PID over exited ones.
+func (t *processTable) trackedParent(node ProcessNode) (ProcessNode, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if parent, ok := t.live[node.PPID]; ok && parent.isParentOf(node) {
+		return parent, true
+	}
+	var latest ProcessNode
+	found := false
+	for key, parent := range t.gone {
+		if key.pid == node.PPID && parent.isParentOf(node) && (!found || parent.StartTime.After(latest.StartTime)) {
+			latest, found = parent, true
+		}
+	}
+	return latest, found
+}
+
+// parentOf returns the parent of node, from the table if it is known there
+// or else from the process source.
+func (t *processTable) parentOf(node ProcessNode) (ProcessNode, bool) {
+	if node.PPID == 0 || node.PPID == node.PID {
+		return ProcessNode{}, false
+	}
+	if parent, ok := t.trackedParent(node); ok {
+		return parent, true
+	}
+	parent, err := t.lookup(node.PPID)
+	if err != nil {
+		return ProcessNode{}, false
+	}
+	return parent, parent.isParentOf(node)
+}
+
+// ancestry returns node followed by up to depth of its ancestors, or all of
+// them if depth is negative.
+func (t *processTable) ancestry(node ProcessNode, depth int) []ProcessNode {
+	chain := []ProcessNode{node}
+	seen := map[int32]bool{node.PID: true}
+	for depth < 0 || len(chain) <= depth {
+		parent, ok := t.parentOf(chain[len(chain)-1])
+		if !ok || seen[parent.PID] {
+			break
+		}
+		seen[parent.PID] = true
+		chain = append(chain, parent)
+	}
+	return chain
+}
+
+// forest links the tracked processes into trees, one per root process.
+func (t *processTable) forest() []*ProcessNode {
+	t.mu.RLock()
+	nodes := make([]*ProcessNode, 0, len(t.live)+len(t.gone))
+	for _, node := range t.live {
+		node.Children = nil
+		nodes = append(nodes, &node)
+	}
+	for _, node := range t.gone {
+		node.Children = nil
+		nodes = append(nodes, &node)
+	}
+	t.mu.RUnlock()
+
+	byPID := make(map[int32][]*ProcessNode, len(nodes))
+	for _, node := range nodes {
+		byPID[node.PID] = append(byPID[node.PID], node)
+	}
+
+	var roots []*ProcessNode
+	for _, node := range nodes {
+		// Of the processes that held the parent PID, the latest one that
+		// could have started the node is its parent.
+		var parent *ProcessNode
+		for _, candidate := range byPID[node.PPID] {
+			if candidate.isParentOf(*node) && (parent == nil || candidate.StartTime.After(parent.StartTime)) {
+				parent = candidate
+			}
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	order := func(a, b *ProcessNode) int {
+		return cmp.Or(cmp.Compare(a.PID, b.PID), a.StartTime.Compare(b.StartTime))
+	}
+	for _, node := range nodes {
+		slices.SortFunc(node.Children, order)
+	}
+	slices.SortFunc(roots, order)
+	return roots
+}
+
+// ProcessTree returns the host's process forest. Exited processes stay in it
+// for the grace period.
+func (s *Scanner) ProcessTree(ctx context.Context) ([]*ProcessNode, error) {
+	nodes, err := s.procSource.Processes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.procTable.refresh(nodes, time.Now())
+	return s.procTable.forest(), nil
+}
+
+// ProcessAncestry returns a process and its ancestors, child first.
+func (s *Scanner) ProcessAncestry(pid int32) ([]ProcessNode, error) {
+	node, ok := s.procTable.get(pid)
+	if !ok || node.ExitTime == nil {
+		// Running processes are read fresh in case the PID was reused.
+		if fresh, err := s.procSource.Process(pid); err == nil {
+			node, ok = fresh, true
+			s.procTable.started(node)
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("process %d not found", pid)
+	}
+	return s.procTable.ancestry(node, -1), nil
+}
@@ -0,0 +1,88 @@
+package agentScanner
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+func newTestTable() *processTable {
+	return newProcessTable(&models.MonitorConfig{}, func(int32) (ProcessNode, error) {
+		return ProcessNode{}, errors.New("not found")
+	})
+}
+
+func chainPIDs(nodes []ProcessNode) []int32 {
+	pids := make([]int32, len(nodes))
+	for i, node := range nodes {
+		pids[i] = node.PID
+	}
+	return pids
+}
+
+func TestProcessTableReparenting(t *testing.T) {
+	table := newTestTable()
+	boot := time.Now().Add(-time.Hour)
+	initProc := ProcessNode{PID: 1, Name: "init", StartTime: boot}
+	parent := ProcessNode{PID: 100, PPID: 1, Name: "sshd", StartTime: boot.Add(time.Minute)}
+	child := ProcessNode{PID: 200, PPID: 100, Name: "bash", StartTime: boot.Add(2 * time.Minute)}
+	table.refresh([]ProcessNode{initProc, parent, child}, time.Now())
+
+	// The parent exits and the child is reparented to init.
+	reparented := child
+	reparented.PPID = 1
+	nodes := []ProcessNode{initProc, reparented}
+	table.refresh(nodes, time.Now())
+
+	if nodes[1].PPID != 100 {
+		t.Errorf("reparented child has PPID %d, want the first seen 100", nodes[1].PPID)
+	}
+	if got := chainPIDs(table.ancestry(nodes[1], -1)); !slices.Equal(got, []int32{200, 100, 1}) {
+		t.Errorf("ancestry = %v, want [200 100 1]", got)
+	}
+
+	// A new process reuses the parent's PID.
+	reuse := ProcessNode{PID: 100, PPID: 1, Name: "cron", StartTime: time.Now()}
+	table.refresh([]ProcessNode{initProc, reparented, reuse}, time.Now())
+
+	chain := table.ancestry(nodes[1], -1)
+	if got := chainPIDs(chain); !slices.Equal(got, []int32{200, 100, 1}) {
+		t.Fatalf("ancestry after PID reuse = %v, want [200 100 1]", got)
+	}
+	if chain[1].Name != "sshd" || chain[1].ExitTime == nil {
+		t.Errorf("ancestor 100 = %s (exited %v), want the exited sshd", chain[1].Name, chain[1].ExitTime != nil)
+	}
+	if node, ok := table.get(100); !ok || node.Name != "cron" {
+		t.Errorf("get(100) = %s, want the running cron", node.Name)
+	}
+
+	roots := table.forest()
+	if len(roots) != 1 || roots[0].PID != 1 {
+		t.Fatalf("roots = %v, want init only", roots)
+	}
+	var names []string
+	for _, node := range roots[0].Children {
+		names = append(names, node.Name)
+		if node.Name == "sshd" && (len(node.Children) != 1 || node.Children[0].PID != 200) {
+			t.Errorf("exited sshd lost its child: %+v", node.Children)
+		}
+	}
+	if !slices.Equal(names, []string{"sshd", "cron"}) {
+		t.Errorf("children of init = %v, want [sshd cron]", names)
+	}
+}
+
+func TestProcessTablePrune(t *testing.T) {
+	table := newTestTable()
+	start := time.Now().Add(-time.Hour)
+	table.refresh([]ProcessNode{{PID: 100, StartTime: start}}, time.Now())
+	table.exited(100, time.Now().Add(-2*models.DefaultExitGraceSeconds*time.Second))
+	table.refresh(nil, time.Now())
+
+	if _, ok := table.get(100); ok {
+		t.Error("process exited past the grace period is still tracked")
+	}
+}
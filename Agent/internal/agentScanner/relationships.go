@@ -0,0 +1,117 @@
+package agentScanner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/rules"
+	"github.com/bhaiFi/security-monitor/internal/signature"
+)
+
+// matchRelationships runs the relationship rules over every process of a scan.
+func (s *Scanner) matchRelationships(table map[int32]ProcessNode) []RelationshipInfo {
+	logPrefix := "agentScanner.matchRelationships"
+
+	if s.relRules == nil || s.relRules.Len() == 0 {
+		return nil
+	}
+
+	signerOf := s.cachedSigner()
+	if s.replaying() {
+		signerOf = recordedSigners(table)
+	}
+	var hits []RelationshipInfo
+	for pid := range table {
+		nodes := s.procTable.ancestry(table[pid], s.relRules.MaxDepth())
+		for _, match := range s.relRules.Match(ruleChain(nodes), signerOf) {
+			hit := newRelationshipInfo(nodes, match)
+			logger.LogInfo(logPrefix, fmt.Sprintf("[Suspicious] %s: %s (%d) -> %s (%d)", match.Rule.ID, hit.ParentName, hit.ParentPID, hit.ChildName, hit.ChildPID), "", match.Rule.Severity)
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+func ruleChain(nodes []ProcessNode) []rules.Process {
+	chain := make([]rules.Process, len(nodes))
+	for i, node := range nodes {
+		chain[i] = node.ruleProcess()
+	}
+	return chain
+}
+
+func newRelationshipInfo(chain []ProcessNode, match rules.RelationshipMatch) RelationshipInfo {
+	child, parent := chain[0], chain[match.Depth]
+
+	refs := make([]ProcessRef, 0, match.Depth+1)
+	for i := match.Depth; i >= 0; i-- {
+		refs = append(refs, ProcessRef{PID: chain[i].PID, Name: chain[i].Name, ExePath: chain[i].ExePath, GUID: chain[i].GUID})
+	}
+
+	return RelationshipInfo{
+		ParentPID:    parent.PID,
+		ParentName:   parent.Name,
+		ChildPID:     child.PID,
+		ChildName:    child.Name,
+		ChildPath:    child.ExePath,
+		ChildCmdline: child.Cmdline,
+		Depth:        match.Depth,
+		Chain:        refs,
+		Rule:         match.Rule,
+	}
+}
+
+// cachedSigner returns a signature lookup that reads each executable once.
+// Where the platform checks trust, a signature that fails it counts as
+// unsigned and its signer is dropped.
+func (s *Scanner) cachedSigner() rules.SignerFunc {
+	logPrefix := "agentScanner.cachedSigner"
+
+	signatures := make(map[string]rules.Signature)
+	return func(exePath string) rules.Signature {
+		if sig, ok := signatures[exePath]; ok {
+			return sig
+		}
+		sig := s.readSignature(logPrefix, exePath)
+		signatures[exePath] = sig
+		return sig
+	}
+}
+
+func (s *Scanner) readSignature(logPrefix, exePath string) rules.Signature {
+	signer, err := s.sigVerifier.Signer(exePath)
+	if err != nil {
+		logger.LogWarning(logPrefix, "Failed to read signer", exePath, err)
+		return rules.Signature{}
+	}
+	verified, err := s.sigVerifier.Verify(exePath)
+	switch {
+	case errors.Is(err, signature.ErrUnsupported):
+		return rules.Signature{Signer: signer, Signed: signer != "", Checked: true}
+	case err != nil && signer == "":
+		logger.LogWarning(logPrefix, "Failed to verify signature", exePath, err)
+		return rules.Signature{}
+	case err != nil || !verified:
+		// A signature that is present but expired, tampered with or
+		// untrusted does not vouch for the file.
+		return rules.Signature{Checked: true}
+	}
+	return rules.Signature{Signer: signer, Signed: true, Checked: true}
+}
+
+// recordedSigners looks signatures up in a replayed snapshot. Only the
+// signer was recorded, so one is taken as a trusted signature. Executables
+// the snapshot does not list are unknown.
+func recordedSigners(table map[int32]ProcessNode) rules.SignerFunc {
+	signers := make(map[string]string, len(table))
+	for _, node := range table {
+		if node.ExePath != "" && signers[node.ExePath] == "" {
+			signers[node.ExePath] = node.Signer
+		}
+	}
+	return func(exePath string) rules.Signature {
+		signer, ok := signers[exePath]
+		return rules.Signature{Signer: signer, Signed: signer != "", Checked: ok}
+	}
+}
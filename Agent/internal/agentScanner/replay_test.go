@@ -0,0 +1,153 @@
+package agentScanner
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/rules"
+	"github.com/bhaiFi/security-monitor/internal/signature"
+	"github.com/bhaiFi/security-monitor/internal/threatintel"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"go.uber.org/zap"
+)
+
+// newReplayScanner builds a scanner that reads its processes from the
+// recorded snapshots in testdata/replay.jsonl and matches them against the
+// shipped relationship rules and path indicators.
+func newReplayScanner(t *testing.T) *Scanner {
+	t.Helper()
+	logger.Logging = zap.NewNop()
+
+	paths, err := filepath.Abs("../../data/malware_paths.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor := &models.MonitorConfig{}
+	ti, err := threatintel.NewThreatIntel(&models.Config{
+		Monitor:     monitor,
+		ThreatIntel: &models.ThreatIntelConfig{Feeds: []models.ThreatFeed{{Path: paths, Format: "path_json"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewThreatIntel: %v", err)
+	}
+	sv, err := signature.NewVerifier()
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	rr, err := rules.LoadRelationshipRules("../../data/relationship_rules.yaml")
+	if err != nil {
+		t.Fatalf("LoadRelationshipRules: %v", err)
+	}
+
+	source, err := NewProcessSource(&models.ProcessSourceConfig{
+		Type:       models.ProcessSourceReplay,
+		ReplayPath: "testdata/replay.jsonl",
+	}, "")
+	if err != nil {
+		t.Fatalf("NewProcessSource: %v", err)
+	}
+
+	s := NewScanner(monitor, ti, sv, rr)
+	s.SetProcessSource(source)
+	return s
+}
+
+func runProcessScan(t *testing.T, s *Scanner) {
+	t.Helper()
+	if err := s.scanProcesses(context.Background(), newScanRun("test")); err != nil {
+		t.Fatalf("scanProcesses: %v", err)
+	}
+}
+
+func TestReplayProcessStage(t *testing.T) {
+	s := newReplayScanner(t)
+
+	// First snapshot: a macro document starts PowerShell, which drops and
+	// runs a binary from C:\Users\Public.
+	runProcessScan(t, s)
+
+	relationships := s.GetSuspiciousRelationships()
+	i := slices.IndexFunc(relationships, func(r RelationshipInfo) bool {
+		return r.Rule.ID == "office-spawns-script-host" && r.ChildPID == 300
+	})
+	if i < 0 {
+		t.Fatalf("office-spawns-script-host was not matched: %+v", relationships)
+	}
+	if r := relationships[i]; r.ParentPID != 200 || r.Depth != 1 {
+		t.Errorf("relationship parent = %d at depth %d, want 200 at depth 1", r.ParentPID, r.Depth)
+	}
+
+	malicious := s.GetMaliciousProcesses()
+	i = slices.IndexFunc(malicious, func(p ProcessInfo) bool { return p.PID == 400 })
+	if i < 0 {
+		t.Fatalf("dropper in C:\\Users\\Public was not flagged: %+v", malicious)
+	}
+	if malicious[i].Indicator == "" {
+		t.Error("dropper was flagged without the matching indicator")
+	}
+	// The files are not on this host, so the hashes come from the snapshot.
+	if malicious[i].SHA256 != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+		t.Errorf("dropper sha256 = %q, want the recorded hash", malicious[i].SHA256)
+	}
+
+	// PowerShell is recorded as signed by Microsoft and the dropper as
+	// unsigned, so the signature rule fires without reading either file.
+	if !slices.ContainsFunc(relationships, func(r RelationshipInfo) bool {
+		return r.Rule.ID == "unsigned-child-of-signed-system-binary" && r.ChildPID == 400 && r.ParentPID == 300
+	}) {
+		t.Errorf("unsigned-child-of-signed-system-binary was not matched on the recorded signers: %+v", relationships)
+	}
+	if slices.ContainsFunc(relationships, func(r RelationshipInfo) bool {
+		return r.Rule.ID == "unsigned-child-of-signed-system-binary" && r.ChildPID != 400
+	}) {
+		t.Errorf("signed processes matched unsigned-child-of-signed-system-binary: %+v", relationships)
+	}
+
+	ancestry, err := s.ProcessAncestry(400)
+	if err != nil {
+		t.Fatalf("ProcessAncestry: %v", err)
+	}
+	var pids []int32
+	for _, p := range ancestry {
+		pids = append(pids, p.PID)
+	}
+	if want := []int32{400, 300, 200, 100, 4}; !slices.Equal(pids, want) {
+		t.Errorf("ancestry = %v, want %v", pids, want)
+	}
+
+	// Second snapshot: PowerShell and the dropper are gone, notepad started.
+	runProcessScan(t, s)
+
+	if relationships := s.GetSuspiciousRelationships(); slices.ContainsFunc(relationships, func(r RelationshipInfo) bool { return r.ChildPID == 300 }) {
+		t.Errorf("relationship of an exited process is still reported: %+v", relationships)
+	}
+	if malicious := s.GetMaliciousProcesses(); len(malicious) != 0 {
+		t.Errorf("exited dropper is still reported: %+v", malicious)
+	}
+	if _, err := s.lookupProcess(500); err != nil {
+		t.Errorf("process started in the second snapshot: %v", err)
+	}
+	if _, err := s.lookupProcess(300); err == nil {
+		t.Error("process gone from the second snapshot was found")
+	}
+
+	// The source keeps returning the last snapshot once it runs out.
+	runProcessScan(t, s)
+	if _, err := s.lookupProcess(500); err != nil {
+		t.Errorf("last snapshot was not replayed again: %v", err)
+	}
+}
+
+func TestReplaySourceErrors(t *testing.T) {
+	logger.Logging = zap.NewNop()
+
+	if _, err := NewReplaySource(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("expected an error for a missing replay file")
+	}
+	if _, err := NewProcessSource(&models.ProcessSourceConfig{Type: "bogus"}, ""); err == nil {
+		t.Error("expected an error for an unknown source type")
+	}
+}
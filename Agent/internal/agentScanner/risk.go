@@ -0,0 +1,285 @@
+package agentScanner
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/bhaiFi/security-monitor/internal/fileanalysis"
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/threatintel"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// Risk factors reported in RiskFactor.Factor, besides the findings they are
+// named after.
+const (
+	RiskReputation         = "reputation"
+	RiskWritableLocation   = "writableLocation"
+	RiskImage              = "imageMismatch"
+	RiskModule             = "suspiciousModule"
+	RiskListener           = "listener"
+	RiskExternalConnection = "externalConnection"
+)
+
+// severityScale scales the relationship weight by rule severity.
+var severityScale = map[string]float64{
+	models.SeverityLow:      0.5,
+	models.SeverityMedium:   1,
+	models.SeverityHigh:     1.5,
+	models.SeverityCritical: 2,
+}
+
+// RiskFactor is one reason a process scored and the points it added.
+type RiskFactor struct {
+	Factor string `json:"factor"`
+	Points int    `json:"points"`
+	Detail string `json:"detail"`
+}
+
+// ProcessRisk is the risk score of a running process with the factors it
+// is made of, highest first. Score is the sum of the points, capped at
+// models.MaxRiskScore.
+type ProcessRisk struct {
+	PID     int32        `json:"pid"`
+	GUID    string       `json:"guid"`
+	Name    string       `json:"name"`
+	ExePath string       `json:"exePath,omitempty"`
+	User    string       `json:"user,omitempty"`
+	Score   int          `json:"score"`
+	Factors []RiskFactor `json:"factors"`
+}
+
+// riskScorer weighs the findings of the latest scans into a score per process.
+type riskScorer struct {
+	weights  models.RiskWeights
+	writable *threatintel.PathMatcher
+}
+
+func newRiskScorer(cfg *models.RiskConfig) *riskScorer {
+	r := &riskScorer{weights: models.DefaultRiskWeights}
+	patterns := models.DefaultWritablePaths
+	if cfg != nil {
+		if cfg.Weights != nil {
+			r.weights = *cfg.Weights
+		}
+		if len(cfg.WritablePaths) > 0 {
+			patterns = cfg.WritablePaths
+		}
+	}
+
+	writable, err := threatintel.CompilePathPatterns(patterns)
+	if err != nil {
+		logger.LogError("agentScanner.newRiskScorer", "Invalid writable paths, using the defaults", "", err)
+		writable, _ = threatintel.CompilePathPatterns(models.DefaultWritablePaths)
+	}
+	r.writable = writable
+	return r
+}
+
+// riskEvidence indexes the findings of the latest scans by the process they
+// belong to: executable path for the per-binary checks, GUID for the
+// per-process checks and PID for sockets.
+type riskEvidence struct {
+	unsigned      map[string]bool
+	malicious     map[string]ProcessInfo
+	relationships map[string][]RelationshipInfo
+	masquerades   map[string]MasqueradeInfo
+	images        map[string]ImageFinding
+	modules       map[string][]ModuleFinding
+	anomalies     map[string][]AnomalyInfo
+	connections   map[int32][]ConnectionInfo
+	static        map[string]*fileanalysis.Analysis
+}
+
+func (s *Scanner) riskEvidence() riskEvidence {
+	ev := riskEvidence{
+		unsigned:      make(map[string]bool),
+		malicious:     make(map[string]ProcessInfo),
+		relationships: make(map[string][]RelationshipInfo),
+		masquerades:   make(map[string]MasqueradeInfo),
+		images:        make(map[string]ImageFinding),
+		modules:       make(map[string][]ModuleFinding),
+		anomalies:     make(map[string][]AnomalyInfo),
+		connections:   make(map[int32][]ConnectionInfo),
+	}
+
+	s.mu.RLock()
+	for _, p := range s.unsignedCache {
+		ev.unsigned[p.ExePath] = true
+	}
+	for _, p := range s.maliciousCache {
+		ev.malicious[p.ExePath] = p
+	}
+	for _, r := range s.relationshipsCache {
+		if len(r.Chain) > 0 {
+			child := r.Chain[len(r.Chain)-1].GUID
+			ev.relationships[child] = append(ev.relationships[child], r)
+		}
+	}
+	for _, m := range s.masqueradesCache {
+		ev.masquerades[m.GUID] = m
+	}
+	for _, i := range s.imageFindingsCache {
+		ev.images[i.GUID] = i
+	}
+	for _, m := range s.moduleFindingsCache {
+		for _, p := range m.Processes {
+			ev.modules[p.GUID] = append(ev.modules[p.GUID], m)
+		}
+	}
+	for _, c := range s.connectionsCache {
+		ev.connections[c.PID] = append(ev.connections[c.PID], c)
+	}
+	ev.static = s.staticCache
+	s.mu.RUnlock()
+
+	for _, a := range s.GetAnomalies() {
+		ev.anomalies[a.GUID] = append(ev.anomalies[a.GUID], a)
+	}
+	return ev
+}
+
+// score weighs everything known about a process.
+func (r *riskScorer) score(node ProcessNode, ev riskEvidence) ProcessRisk {
+	w := r.weights
+	risk := ProcessRisk{PID: node.PID, GUID: node.GUID, Name: node.Name, ExePath: node.ExePath, User: node.User}
+	add := func(factor string, points int, detail string) {
+		if points > 0 {
+			risk.Factors = append(risk.Factors, RiskFactor{Factor: factor, Points: points, Detail: detail})
+		}
+	}
+
+	if ev.unsigned[node.ExePath] {
+		add(FindingUnsigned, w.Unsigned, "executable is not signed")
+	}
+	if info, ok := ev.malicious[node.ExePath]; ok {
+		if hash, ok := strings.CutPrefix(info.Indicator, "reputation:"); ok {
+			add(RiskReputation, w.Reputation, fmt.Sprintf("reputation provider flagged %s", hash))
+		} else if info.Indicator != "" {
+			add(FindingPathIndicator, w.PathIndicator, fmt.Sprintf("path matches indicator %s", info.Indicator))
+		} else {
+			add(FindingMaliciousHash, w.MaliciousHash, fmt.Sprintf("hash %s is in the threat feeds", info.SHA256))
+		}
+	}
+	if analysis := ev.static[node.ExePath]; analysis != nil {
+		traitWeights := map[string]int{
+			fileanalysis.TraitPacked:             w.Packed,
+			fileanalysis.TraitHighEntropy:        w.HighEntropy,
+			fileanalysis.TraitWritableExecutable: w.WritableExecutable,
+			fileanalysis.TraitEntryOutsideText:   w.EntryOutsideText,
+			fileanalysis.TraitOverlay:            w.Overlay,
+			fileanalysis.TraitNoImports:          w.NoImports,
+			fileanalysis.TraitWritableRPath:      w.WritableRPath,
+			fileanalysis.TraitUnusualInterpreter: w.UnusualInterpreter,
+			fileanalysis.TraitStaticInUserDir:    w.StaticInUserDir,
+			fileanalysis.TraitSetuid:             w.Setuid,
+			fileanalysis.TraitFileCapabilities:   w.FileCapabilities,
+		}
+		// A trait found in several sections counts once.
+		scored := make(map[string]bool)
+		for _, trait := range analysis.Traits {
+			if !scored[trait.Name] {
+				scored[trait.Name] = true
+				add(trait.Name, traitWeights[trait.Name], trait.Detail)
+			}
+		}
+	}
+	if r.writable.Match(node.ExePath) {
+		add(RiskWritableLocation, w.WritableLocation, "runs from a temporary or user-writable directory")
+	}
+	for _, hit := range ev.relationships[node.GUID] {
+		scale, ok := severityScale[hit.Rule.Severity]
+		if !ok {
+			scale = 1
+		}
+		add(FindingSuspiciousRelationship, weighted(w.Relationship, scale),
+			fmt.Sprintf("rule %s (%s): started by %s", hit.Rule.ID, hit.Rule.Severity, hit.ParentName))
+	}
+	if m, ok := ev.masquerades[node.GUID]; ok {
+		details := make([]string, 0, len(m.Findings))
+		for _, f := range m.Findings {
+			details = append(details, fmt.Sprintf("%s %s", f.Reason, f.Detail))
+		}
+		add(FindingMasquerade, w.Masquerade, fmt.Sprintf("imitates %s: %s", m.Findings[0].Imitates, strings.Join(details, "; ")))
+	}
+	if i, ok := ev.images[node.GUID]; ok {
+		add(RiskImage, w.Image, strings.Join(i.Details, "; "))
+	}
+	if modules := ev.modules[node.GUID]; len(modules) > 0 {
+		paths := make([]string, 0, len(modules))
+		for _, m := range modules {
+			paths = append(paths, fmt.Sprintf("%s (%s)", m.Path, strings.Join(m.Findings, ", ")))
+		}
+		add(RiskModule, w.Module, "loads "+strings.Join(paths, "; "))
+	}
+	for _, a := range ev.anomalies[node.GUID] {
+		add(FindingAnomaly, weighted(w.Anomaly, a.Rarity),
+			fmt.Sprintf("%s %q never seen for %s (rarity %.3f)", a.Type, a.Value, a.Context, a.Rarity))
+	}
+
+	var listening, external []string
+	for _, c := range ev.connections[node.PID] {
+		if (c.Protocol == "tcp" && c.Status == "LISTEN") || (c.Protocol == "udp" && c.RemoteAddr == "") {
+			listening = append(listening, fmt.Sprintf("%s/%s", c.Protocol, c.LocalAddr))
+		} else if isExternalAddr(c.RemoteAddr) {
+			external = append(external, fmt.Sprintf("%s/%s", c.Protocol, c.RemoteAddr))
+		}
+	}
+	if len(listening) > 0 {
+		add(RiskListener, w.Listener, "listens on "+strings.Join(listening, ", "))
+	}
+	if len(external) > 0 {
+		add(RiskExternalConnection, w.ExternalConnection, "connected to "+strings.Join(external, ", "))
+	}
+
+	slices.SortStableFunc(risk.Factors, func(a, b RiskFactor) int { return cmp.Compare(b.Points, a.Points) })
+	for _, f := range risk.Factors {
+		risk.Score += f.Points
+	}
+	risk.Score = min(risk.Score, models.MaxRiskScore)
+	return risk
+}
+
+func weighted(weight int, scale float64) int {
+	return int(math.Round(float64(weight) * scale))
+}
+
+// isExternalAddr reports whether a host:port address is routable on the
+// internet, as opposed to loopback, private or link-local.
+func isExternalAddr(hostPort string) bool {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// RiskRanking scores every running process on the findings of the latest
+// scans and returns those with a score, highest first.
+func (s *Scanner) RiskRanking() []ProcessRisk {
+	ev := s.riskEvidence()
+
+	var ranking []ProcessRisk
+	for _, node := range s.procTable.running() {
+		if risk := s.risk.score(node, ev); risk.Score > 0 {
+			ranking = append(ranking, risk)
+		}
+	}
+	slices.SortFunc(ranking, func(a, b ProcessRisk) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.PID, b.PID)
+	})
+	return ranking
+}
@@ -1,161 +1,484 @@
 package agentScanner
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bhaiFi/security-monitor/internal/fileanalysis"
+	"github.com/bhaiFi/security-monitor/internal/governor"
 	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/rules"
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+	"github.com/bhaiFi/security-monitor/internal/scheduler"
 	"github.com/bhaiFi/security-monitor/internal/signature"
 	"github.com/bhaiFi/security-monitor/internal/threatintel"
 	"github.com/bhaiFi/security-monitor/pkg/models"
-	"github.com/shirou/gopsutil/v3/process"
 )
 
+// ProcessInfo is a reported process with the details needed to triage it
+// without going back to the host. GUID identifies the process across PID reuse.
 type ProcessInfo struct {
-	PID     int32   `json:"pid"`
-	Name    string  `json:"name"`
-	ExePath string  `json:"exePath"`
-	Signer  *string `json:"signer,omitempty"`
+	PID            int32     `json:"pid"`
+	Name           string    `json:"name"`
+	ExePath        string    `json:"exePath"`
+	Signer         *string   `json:"signer,omitempty"`
+	Indicator      string    `json:"indicator,omitempty"`
+	GUID           string    `json:"guid"`
+	PPID           int32     `json:"ppid"`
+	Cmdline        string    `json:"cmdline,omitempty"`
+	User           string    `json:"user,omitempty"`
+	UID            string    `json:"uid,omitempty"`
+	StartTime      time.Time `json:"startTime"`
+	Cwd            string    `json:"cwd,omitempty"`
+	IntegrityLevel string    `json:"integrityLevel,omitempty"`
+	MD5            string    `json:"md5,omitempty"`
+	SHA256         string    `json:"sha256,omitempty"`
+	PartialSHA256  string    `json:"partialSha256,omitempty"`
+	Size           int64     `json:"size"`
+	ModTime        time.Time `json:"modTime"`
 }
 
+// RelationshipInfo is a relationship rule hit. The parent is the ancestor the
+// rule matched, Depth levels above the child; Chain lists the processes from
+// that ancestor down to the child.
 type RelationshipInfo struct {
-	ParentPID  int32  `json:"parentPid"`
-	ParentName string `json:"parentName"`
-	ChildPID   int32  `json:"childPid"`
-	ChildName  string `json:"childName"`
+	ParentPID    int32                   `json:"parentPid"`
+	ParentName   string                  `json:"parentName"`
+	ChildPID     int32                   `json:"childPid"`
+	ChildName    string                  `json:"childName"`
+	ChildPath    string                  `json:"childPath,omitempty"`
+	ChildCmdline string                  `json:"childCmdline,omitempty"`
+	Depth        int                     `json:"depth"`
+	Chain        []ProcessRef            `json:"chain"`
+	Rule         models.RelationshipRule `json:"rule"`
+}
+
+// ProcessRef identifies a process in a relationship chain.
+type ProcessRef struct {
+	PID     int32  `json:"pid"`
+	Name    string `json:"name"`
+	ExePath string `json:"exePath,omitempty"`
+	GUID    string `json:"guid,omitempty"`
 }
 
 type Scanner struct {
 	config      *models.MonitorConfig
 	threatIntel *threatintel.ThreatIntel
 	sigVerifier *signature.Verifier
-
-	unsignedCache      []ProcessInfo
-	maliciousCache     []ProcessInfo
-	relationshipsCache []RelationshipInfo
+	relRules    *rules.RelationshipEngine
+	masquerade  *rules.MasqueradeChecker
+	learner     *baselineLearner
+	risk        *riskScorer
+	analyses    *analysisCache
+	governor    *governor.Governor
+	store       *scanstore.Store
+	history     *executionHistory
+	scheduler   *scheduler.Scheduler
+	events      *eventHub
+	procEvents  *eventRing
+	procTable   *processTable
+	procSource  ProcessSource
+	changes     *changeTracker
+
+	persistBaseline *persistenceBaseline
+
+	unsignedCache       []ProcessInfo
+	maliciousCache      []ProcessInfo
+	relationshipsCache  []RelationshipInfo
+	masqueradesCache    []MasqueradeInfo
+	pathMatchesCache    []PathMatchInfo
+	fileFindingsCache   []FileFinding
+	moduleFindingsCache []ModuleFinding
+	imageFindingsCache  []ImageFinding
+	retroHuntCache      []RetroHuntHit
+	connectionsCache    []ConnectionInfo
+	persistenceCache    []PersistenceEntry
+	staticCache         map[string]*fileanalysis.Analysis
+
+	ctx        context.Context
+	currentRun *ScanRun
+	runMu      sync.Mutex
 
 	mu sync.RWMutex
 }
 
-func NewScanner(cfg *models.MonitorConfig, ti *threatintel.ThreatIntel, sv *signature.Verifier) *Scanner {
-	return &Scanner{
+func NewScanner(cfg *models.MonitorConfig, ti *threatintel.ThreatIntel, sv *signature.Verifier, rr *rules.RelationshipEngine) *Scanner {
+	s := &Scanner{
 		config:      cfg,
 		threatIntel: ti,
 		sigVerifier: sv,
+		relRules:    rr,
+		history:     newExecutionHistory(cfg.HistorySize),
+		scheduler:   scheduler.New(),
+		events:      newEventHub(),
+		procEvents:  newEventRing(processEventBuffer(cfg)),
+		procSource:  NewDefaultProcessSource(),
+		changes:     newChangeTracker(cfg.ChangeBufferSize),
+		risk:        newRiskScorer(cfg.Risk),
+		analyses:    newAnalysisCache(),
+		governor:    governor.New(cfg.Governor),
+
+		persistBaseline: newPersistenceBaseline(cfg),
 	}
+	s.procTable = newProcessTable(cfg, s.lookupProcess)
+	if cfg.Learning != nil && cfg.Learning.Enabled {
+		s.learner = newBaselineLearner(cfg.Learning)
+	}
+	ti.OnUpdate(s.retroHunt)
+	return s
 }
 
-func (s *Scanner) startScanning(ctx context.Context) {
-	logPrefix := "agentScanner.startScanning"
+// StartBackground schedules the process, filesystem, network and, on Linux,
+// persistence stages.
+func (s *Scanner) StartBackground(ctx context.Context) {
+	logPrefix := "agentScanner.StartBackground"
 
-	s.scanAll() // initial scan
+	s.runMu.Lock()
+	s.ctx = ctx
+	s.runMu.Unlock()
 
-	ticker := time.NewTicker(time.Duration(models.TimeInterval) * time.Second)
-	defer ticker.Stop()
+	type stage struct {
+		name string
+		run  func(ctx context.Context)
+	}
+	stages := []stage{
+		{models.StageProcess, s.scanAll},
+		{models.StageFilesystem, s.scanFilesystem},
+		{models.StageNetwork, s.scanNetwork},
+	}
+	if persistenceSupported && s.persistenceEnabled() {
+		stages = append(stages, stage{models.StagePersistence, s.scanPersistence})
+	}
 
-	for {
-		select {
-		case <-ticker.C:
-			s.scanAll()
-		case <-ctx.Done():
-			logger.LogInfo(logPrefix, "Scanner shutting down", "", nil)
-			return
+	for _, stage := range stages {
+		schedule := s.stageSchedule(stage.name)
+		if err := s.scheduler.Register(stage.name, schedule, stage.run); err != nil {
+			logger.LogError(logPrefix, "Invalid stage schedule, falling back to the default interval", stage.name, err)
+			schedule = models.StageSchedule{IntervalSeconds: s.defaultInterval()}
+			s.scheduler.Register(stage.name, schedule, stage.run)
 		}
 	}
+
+	s.scheduler.Start(ctx)
+	s.startFileWatcher(ctx)
+
+	// Live process events would mix with a replayed process list.
+	if !s.replaying() {
+		s.startProcessEvents(ctx)
+	}
 }
 
-func (s *Scanner) StartBackground(ctx context.Context) {
-	go s.startScanning(ctx)
+// SetProcessSource replaces the source the process stage reads from. It must
+// be called before StartBackground.
+func (s *Scanner) SetProcessSource(source ProcessSource) {
+	s.procSource = source
+}
+
+// replaying reports whether the processes come from recorded snapshots. The
+// files, images and modules of the live host do not describe them.
+func (s *Scanner) replaying() bool {
+	_, ok := s.procSource.(*ReplaySource)
+	return ok
+}
+
+func (s *Scanner) lookupProcess(pid int32) (ProcessNode, error) {
+	return s.procSource.Process(pid)
 }
 
-func (s *Scanner) scanAll() {
-	logPrefix := "agentScanner.scanAll"
+// ScanMetrics returns how long the scan stages take and how much the
+// governor has throttled them.
+func (s *Scanner) ScanMetrics() governor.Metrics {
+	return s.governor.Metrics()
+}
+
+// GetSchedule returns the current schedule of every scan stage.
+func (s *Scanner) GetSchedule() []scheduler.StageStatus {
+	return s.scheduler.Status()
+}
 
-	processes, err := process.Processes()
+// UpdateSchedule changes the schedule of a scan stage until the agent restarts.
+func (s *Scanner) UpdateSchedule(stage string, schedule models.StageSchedule) error {
+	return s.scheduler.Update(stage, schedule)
+}
+
+func processEventBuffer(cfg *models.MonitorConfig) int {
+	if cfg.ProcessEvents == nil {
+		return 0
+	}
+	return cfg.ProcessEvents.BufferSize
+}
+
+func (s *Scanner) defaultInterval() int {
+	if s.config.IntervalSeconds > 0 {
+		return s.config.IntervalSeconds
+	}
+	return models.TimeInterval
+}
+
+// stageSchedule resolves the configured schedule of a stage. Stages without
+// an interval or cron expression use monitor.interval_seconds.
+func (s *Scanner) stageSchedule(stage string) models.StageSchedule {
+	var schedule models.StageSchedule
+	if cfg := s.config.Schedule; cfg != nil {
+		switch stage {
+		case models.StageProcess:
+			schedule = cfg.Process
+		case models.StageFilesystem:
+			schedule = cfg.Filesystem
+		case models.StageNetwork:
+			schedule = cfg.Network
+		case models.StagePersistence:
+			schedule = cfg.Persistence
+		}
+	}
+	if schedule.Cron == "" && schedule.IntervalSeconds <= 0 {
+		schedule.IntervalSeconds = s.defaultInterval()
+	}
+	return schedule
+}
+
+// scanAll is the process stage. It waits for the scan so scheduled runs
+// never pile up, and joins an on-demand scan if one is already running.
+func (s *Scanner) scanAll(ctx context.Context) {
+	run := s.startProcessScan("scheduled")
+	select {
+	case <-run.Done():
+	case <-ctx.Done():
+	}
+}
+
+func (s *Scanner) scanProcesses(ctx context.Context, run *ScanRun) error {
+	logPrefix := "agentScanner.scanProcesses"
+	defer s.governor.ObserveScan(models.StageProcess, time.Now())
+
+	processes, err := s.procSource.Processes(ctx)
 	if err != nil {
-		logger.LogError(logPrefix, "Failed to get process list", "", err)
-		return
+		logger.LogError(logPrefix, "Failed to get process list", s.procSource.Name(), err)
+		return fmt.Errorf("failed to get process list: %w", err)
 	}
+	slices.SortFunc(processes, func(a, b ProcessNode) int { return cmp.Compare(a.PID, b.PID) })
 
 	logger.LogInfo(logPrefix, fmt.Sprintf("Length of the Processes - %d", len(processes)), "", nil)
 
 	var unsigned []ProcessInfo
 	var malicious []ProcessInfo
 	var relationships []RelationshipInfo
+	var images []ImageFinding
+
+	replay := s.replaying()
+
+	// Refreshing first gives processes whose parent exited the parent they
+	// were first seen with.
+	s.procTable.refresh(processes, time.Now())
+	table := nodeMap(processes)
+	files := make(map[string]*exeFile)
+	analyses := make(map[string]*fileanalysis.Analysis)
+	unknownHashes := make(map[string]ProcessInfo)
+	scanTime := time.Now()
+
+	checks := s.checkProcesses(ctx, run, processes, scanTime, replay)
+	if ctx.Err() != nil {
+		return fmt.Errorf("process scan interrupted: %w", ctx.Err())
+	}
 
-	unsignedSeen := make(map[string]bool)
-	maliciousMap := make(map[string]bool)
-
-	for _, p := range processes {
-		pid := p.Pid
-
-		name, err := p.Name()
-		if err != nil {
-			logger.LogError(logPrefix, "Failed to get process name", fmt.Sprintf("PID: %d", pid), err)
-			continue
+	for i, p := range processes {
+		check := checks[i]
+		if check.image != nil {
+			logger.LogInfo(logPrefix, "[Suspicious] Running image does not match a file on disk", p.ExePath, check.image.Findings)
+			images = append(images, *check.image)
 		}
 
-		exe, err := p.Exe()
-		if err != nil {
-			logger.LogError(logPrefix, "Failed to get executable path", fmt.Sprintf("PID: %d", pid), err)
+		file := check.file
+		if file == nil {
 			continue
 		}
+		files[p.ExePath] = file
+		info := newProcessInfo(p, file)
 
-		if exe == "" {
-			continue
+		if check.analysis != nil && len(check.analysis.Traits) > 0 {
+			analyses[p.ExePath] = check.analysis
 		}
 
-		if isSigned, err := s.sigVerifier.Verify(exe); err == nil && !isSigned {
-			if _, exists := unsignedSeen[exe]; !exists {
-				unsignedSeen[exe] = true
-				unsigned = append(unsigned, ProcessInfo{
-					PID:     pid,
-					Name:    name,
-					ExePath: exe,
-				})
-			}
-		} else if err != nil {
-			logger.LogError(logPrefix, "Signature verification failed", exe, err)
+		if file.unsigned {
+			unsigned = append(unsigned, info)
 		}
 
-		if exe != "" && s.threatIntel.IsMalicious(exe) {
-			if _, exist := maliciousMap[exe]; !exist {
-				maliciousMap[exe] = true
-				malicious = append(malicious, ProcessInfo{
-					PID:     pid,
-					Name:    name,
-					ExePath: exe,
-				})
-			}
+		if ioc, matched := s.threatIntel.MatchPath(p.ExePath); matched {
+			info.Indicator = ioc.Pattern
+			malicious = append(malicious, info)
+		} else if file.hashed && s.threatIntel.IsMaliciousHash(file.md5, file.sha256) {
+			malicious = append(malicious, info)
+		} else if file.hashed {
+			unknownHashes[file.sha256] = info
 		}
+	}
 
-		if parent, err := p.Parent(); err == nil && parent != nil {
-			parentName, err := parent.Name()
-			if err != nil {
-				logger.LogError(logPrefix, "Failed to get parent process name", fmt.Sprintf("Parent PID: %d", parent.Pid), err)
-				continue
-			}
+	relationships = s.matchRelationships(table)
+	masquerades := s.matchMasquerades(table)
+	anomalies := s.learnProcesses(processes, scanTime)
 
-			relationships = append(relationships, RelationshipInfo{
-				ParentPID:  parent.Pid,
-				ParentName: parentName,
-				ChildPID:   pid,
-				ChildName:  name,
-			})
+	if !replay {
+		malicious = append(malicious, s.checkReputation(ctx, unknownHashes)...)
+	}
 
-			if isSuspiciousParent(parentName) && isSuspiciousChild(name) {
-				logger.LogInfo(logPrefix, fmt.Sprintf("[Suspicious] Parent: %s (%d) -> Child: %s (%d)", parentName, parent.Pid, name, pid), "", nil)
-			}
-		}
+	var modules []ModuleFinding
+	if s.modulesEnabled() && !replay {
+		modules = s.scanModules(ctx, processes, files, scanTime)
 	}
 
+	run.update(func(progress *ScanProgress) {
+		progress.ProcessesTotal = len(processes)
+		progress.ProcessesInspected = len(processes)
+		progress.UnsignedFound = len(unsigned)
+		progress.MaliciousFound = len(malicious)
+		progress.RelationshipsFound = len(relationships)
+		progress.ModuleFindings = len(modules)
+		progress.MasqueradesFound = len(masquerades)
+		progress.ImageFindings = len(images)
+		progress.AnomaliesFound = len(anomalies)
+	})
+
 	s.mu.Lock()
 	s.unsignedCache = unsigned
 	s.maliciousCache = malicious
 	s.relationshipsCache = relationships
+	s.masqueradesCache = masquerades
+	s.moduleFindingsCache = modules
+	s.imageFindingsCache = images
+	s.staticCache = analyses
 	s.mu.Unlock()
+
+	s.storeProcessSnapshot(processes, files, scanTime)
+	s.trackProcessScan(processes, unsigned, malicious, relationships, modules)
+	s.trackChanges(ChangeMasquerade, keyed(masquerades, func(m MasqueradeInfo) string { return m.GUID }))
+	s.trackChanges(ChangeImage, keyed(images, func(i ImageFinding) string { return i.GUID }))
+
+	return nil
+}
+
+// processCheck is what the per-process checks found. file and analysis are
+// only set for the first process running each executable.
+type processCheck struct {
+	image    *ImageFinding
+	file     *exeFile
+	analysis *fileanalysis.Analysis
+}
+
+// checkProcesses runs the image check on every process and inspects each
+// executable once, for the first process running it, spread over the
+// governor's workers. The checks are indexed like processes. Replayed
+// processes only get what their snapshot recorded.
+func (s *Scanner) checkProcesses(ctx context.Context, run *ScanRun, processes []ProcessNode, scanTime time.Time, replay bool) []processCheck {
+	checkImages := s.imageChecksEnabled() && !replay
+	checkStatic := s.staticAnalysisEnabled() && !replay
+
+	// Kernel threads and processes the agent may not inspect have no
+	// executable path. Deleted and memory-only executables have no file to
+	// inspect; the image check covers them.
+	inspect := make([]bool, len(processes))
+	seen := make(map[string]bool)
+	for i, p := range processes {
+		if p.ExePath != "" && !isDeletedPath(p.ExePath) && !seen[p.ExePath] {
+			seen[p.ExePath] = true
+			inspect[i] = true
+		}
+	}
+
+	checks := make([]processCheck, len(processes))
+	indexes := make(chan int)
+	var inspected atomic.Int64
+	var wg sync.WaitGroup
+
+	for range s.governor.Workers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				p, check := processes[i], &checks[i]
+				ran := s.governed(ctx, func() {
+					if checkImages {
+						if image, ok := s.checkImage(ctx, p, scanTime); ok {
+							check.image = &image
+						}
+					}
+					if inspect[i] && replay {
+						check.file = recordedFile(p)
+					} else if inspect[i] {
+						check.file = s.inspectExecutable(ctx, p.ExePath, scanTime)
+						if checkStatic {
+							check.analysis = s.analyzeExecutable(ctx, p.ExePath, check.file)
+						}
+					}
+				})
+				if !ran {
+					continue
+				}
+
+				done := int(inspected.Add(1))
+				run.update(func(progress *ScanProgress) {
+					progress.ProcessesTotal = len(processes)
+					progress.ProcessesInspected = max(progress.ProcessesInspected, done)
+				})
+			}
+		}()
+	}
+
+	for i := range processes {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return checks
+}
+
+// checkReputation asks the external reputation provider, if one is configured,
+// about hashes the local feeds do not know.
+func (s *Scanner) checkReputation(ctx context.Context, unknown map[string]ProcessInfo) []ProcessInfo {
+	logPrefix := "agentScanner.checkReputation"
+
+	hashes := make([]string, 0, len(unknown))
+	for hash := range unknown {
+		hashes = append(hashes, hash)
+	}
+
+	var malicious []ProcessInfo
+	for hash, verdict := range s.lookupReputation(ctx, hashes) {
+		info, ok := unknown[hash]
+		if !ok || !verdict.Malicious {
+			continue
+		}
+		info.Indicator = "reputation:" + hash
+		malicious = append(malicious, info)
+		logger.LogInfo(logPrefix, "Reputation provider flagged binary", info.ExePath, verdict.Type)
+	}
+	return malicious
+}
+
+// lookupReputation asks the reputation provider, if one is configured, for
+// verdicts on hashes the local feeds do not know.
+func (s *Scanner) lookupReputation(ctx context.Context, hashes []string) map[string]threatintel.Verdict {
+	provider := s.threatIntel.Reputation()
+	if provider == nil || len(hashes) == 0 {
+		return nil
+	}
+
+	verdicts, err := provider.Lookup(ctx, hashes)
+	if err != nil {
+		// Verdicts gathered before the failure are still used.
+		logger.LogError("agentScanner.lookupReputation", "Reputation lookup incomplete", fmt.Sprintf("%d hashes", len(hashes)), err)
+	}
+	return verdicts
 }
 
 func (s *Scanner) GetUnsignedProcesses() []ProcessInfo {
@@ -170,29 +493,16 @@ func (s *Scanner) GetMaliciousProcesses() []ProcessInfo {
 	return s.maliciousCache
 }
 
+// GetSuspiciousRelationships returns the relationship rule hits of the last
+// process scan.
 func (s *Scanner) GetSuspiciousRelationships() []RelationshipInfo {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.relationshipsCache
 }
 
-func isSuspiciousParent(name string) bool {
-	suspiciousParents := map[string]bool{
-		"winword.exe":  true,
-		"excel.exe":    true,
-		"powerpnt.exe": true,
-		"outlook.exe":  true,
-	}
-	return suspiciousParents[name]
-}
-
-func isSuspiciousChild(name string) bool {
-	suspiciousChildren := map[string]bool{
-		"powershell.exe": true,
-		"cmd.exe":        true,
-		"wscript.exe":    true,
-		"cscript.exe":    true,
-		"mshta.exe":      true,
-	}
-	return suspiciousChildren[name]
+func (s *Scanner) GetPathIndicatorMatches() []PathMatchInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pathMatchesCache
 }
@@ -0,0 +1,171 @@
+package agentScanner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+)
+
+// Scan run states reported in ScanProgress.
+const (
+	ScanRunning   = "running"
+	ScanCompleted = "completed"
+	ScanFailed    = "failed"
+)
+
+// ScanProgress is the state of a process scan, sent while it runs and once
+// more as the final summary.
+type ScanProgress struct {
+	ScanID             string    `json:"scanId"`
+	Trigger            string    `json:"trigger"`
+	State              string    `json:"state"`
+	ProcessesTotal     int       `json:"processesTotal"`
+	ProcessesInspected int       `json:"processesInspected"`
+	UnsignedFound      int       `json:"unsignedFound"`
+	MaliciousFound     int       `json:"maliciousFound"`
+	RelationshipsFound int       `json:"relationshipsFound"`
+	ModuleFindings     int       `json:"moduleFindings"`
+	MasqueradesFound   int       `json:"masqueradesFound"`
+	ImageFindings      int       `json:"imageFindings"`
+	AnomaliesFound     int       `json:"anomaliesFound"`
+	Error              string    `json:"error,omitempty"`
+	StartedAt          time.Time `json:"startedAt"`
+	FinishedAt         time.Time `json:"finishedAt,omitempty"`
+}
+
+// ScanRun is a single process scan that any number of callers can follow.
+type ScanRun struct {
+	progress    ScanProgress
+	subscribers []chan ScanProgress
+	done        chan struct{}
+	mu          sync.Mutex
+}
+
+func newScanRun(trigger string) *ScanRun {
+	return &ScanRun{
+		progress: ScanProgress{
+			ScanID:    newScanID(),
+			Trigger:   trigger,
+			State:     ScanRunning,
+			StartedAt: time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+}
+
+func newScanID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (r *ScanRun) ID() string {
+	return r.progress.ScanID
+}
+
+// Done is closed when the scan has finished.
+func (r *ScanRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// Summary returns the latest progress, which is the final summary once Done
+// is closed.
+func (r *ScanRun) Summary() ScanProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress
+}
+
+// Subscribe returns a channel carrying progress updates. Slow subscribers
+// only see the most recent update; the channel is closed when the scan ends.
+func (r *ScanRun) Subscribe() <-chan ScanProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan ScanProgress, 1)
+	select {
+	case <-r.done:
+		close(ch)
+	default:
+		ch <- r.progress
+		r.subscribers = append(r.subscribers, ch)
+	}
+	return ch
+}
+
+func (r *ScanRun) update(fn func(p *ScanProgress)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn(&r.progress)
+	for _, ch := range r.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- r.progress
+	}
+}
+
+func (r *ScanRun) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress.State = ScanCompleted
+	if err != nil {
+		r.progress.State = ScanFailed
+		r.progress.Error = err.Error()
+	}
+	r.progress.FinishedAt = time.Now()
+
+	for _, ch := range r.subscribers {
+		close(ch)
+	}
+	r.subscribers = nil
+	close(r.done)
+}
+
+// ScanNow starts a process scan, or joins the one already in progress so
+// concurrent requests never run duplicate scans.
+func (s *Scanner) ScanNow() *ScanRun {
+	return s.startProcessScan("onDemand")
+}
+
+func (s *Scanner) startProcessScan(trigger string) *ScanRun {
+	logPrefix := "agentScanner.startProcessScan"
+
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	if s.currentRun != nil {
+		logger.LogInfo(logPrefix, "Joining scan already in progress", s.currentRun.ID(), trigger)
+		return s.currentRun
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	run := newScanRun(trigger)
+	s.currentRun = run
+	logger.LogInfo(logPrefix, "Starting process scan", run.ID(), trigger)
+
+	go func() {
+		err := s.scanProcesses(ctx, run)
+
+		s.runMu.Lock()
+		s.currentRun = nil
+		s.runMu.Unlock()
+
+		run.finish(err)
+	}()
+
+	return run
+}
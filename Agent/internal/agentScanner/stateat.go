@@ -0,0 +1,240 @@
+package agentScanner
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+)
+
+// Where a process in a reconstructed state was learned from.
+const (
+	StateSnapshot     = "snapshot"
+	StateNextSnapshot = "nextSnapshot"
+	StateProcessStart = "processStart"
+)
+
+// HostState is what was running on the host at a moment in the past,
+// rebuilt from the process snapshots taken before and after it, the
+// process events in between and the latest connection snapshot. Truncated
+// is set when not all of those events could be read.
+type HostState struct {
+	At                 time.Time        `json:"at"`
+	SnapshotAt         time.Time        `json:"snapshotAt"`
+	NextSnapshotAt     *time.Time       `json:"nextSnapshotAt,omitempty"`
+	ConnectionsAt      *time.Time       `json:"connectionsAt,omitempty"`
+	Processes          []StateProcess   `json:"processes"`
+	UnownedConnections []ConnectionInfo `json:"unownedConnections,omitempty"`
+	Truncated          bool             `json:"truncated,omitempty"`
+}
+
+// StateProcess is a process running at the requested moment, with its
+// parent and its connections. MayHaveExited is set when the process was gone
+// by the next snapshot and no exit event tells whether it left before the
+// requested moment.
+type StateProcess struct {
+	ProcessInfo
+	Parent        *ProcessRef      `json:"parent,omitempty"`
+	Connections   []ConnectionInfo `json:"connections,omitempty"`
+	Source        string           `json:"source"`
+	MayHaveExited bool             `json:"mayHaveExited,omitempty"`
+}
+
+// StateAt reconstructs the processes and connections of the host at t from
+// the history store.
+func (s *Scanner) StateAt(t time.Time) (*HostState, error) {
+	if s.store == nil {
+		return nil, fmt.Errorf("history store is not enabled")
+	}
+
+	before, err := s.store.SnapshotBefore(SnapshotProcess, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(before) == 0 {
+		return nil, fmt.Errorf("no process snapshot at or before %s", t.Format(time.RFC3339))
+	}
+	after, err := s.store.SnapshotAfter(SnapshotProcess, t)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &HostState{At: t, SnapshotAt: before[0].Time}
+	running := make(map[string]*StateProcess)
+	for _, p := range decodeRecords[ProcessInfo](before) {
+		running[processKey(p.GUID, p.PID)] = &StateProcess{ProcessInfo: p, Source: StateSnapshot}
+	}
+
+	// A process in the next snapshot that had already started was running at
+	// t. One missing from it exited at some point between the snapshots.
+	later := make(map[string]ProcessInfo)
+	end := t.Add(time.Nanosecond)
+	if len(after) > 0 {
+		state.NextSnapshotAt = &after[0].Time
+		end = after[0].Time
+		for _, p := range decodeRecords[ProcessInfo](after) {
+			key := processKey(p.GUID, p.PID)
+			later[key] = p
+			if _, ok := running[key]; !ok && !p.StartTime.IsZero() && !p.StartTime.After(t) {
+				running[key] = &StateProcess{ProcessInfo: p, Source: StateNextSnapshot}
+			}
+		}
+		for key, p := range running {
+			if _, ok := later[key]; !ok {
+				p.MayHaveExited = true
+			}
+		}
+	}
+
+	events, truncated, err := s.processEvents(state.SnapshotAt, end)
+	if err != nil {
+		return nil, err
+	}
+	state.Truncated = truncated
+	for _, ev := range decodeRecords[ProcessEvent](events) {
+		key := processKey(ev.GUID, ev.PID)
+		switch {
+		case ev.Type == EventProcessStart && !ev.Time.After(t):
+			if _, ok := running[key]; ok {
+				continue
+			}
+			info, ok := later[key]
+			if !ok {
+				info = ProcessInfo{PID: ev.PID, PPID: ev.PPID, Name: ev.Name, ExePath: ev.ExePath, GUID: ev.GUID, Cmdline: ev.Cmdline, User: ev.User, StartTime: ev.Time, MD5: ev.MD5, SHA256: ev.SHA256}
+			}
+			running[key] = &StateProcess{ProcessInfo: info, Source: StateProcessStart, MayHaveExited: !ok && len(after) > 0}
+		case ev.Type == EventProcessExit && !ev.Time.After(t):
+			if ev.GUID != "" {
+				delete(running, key)
+				continue
+			}
+			for key, p := range running {
+				if p.PID == ev.PID && !p.StartTime.After(ev.Time) {
+					delete(running, key)
+				}
+			}
+		case ev.Type == EventProcessExit:
+			// Exited after t, so it was still running at t.
+			for _, p := range running {
+				if p.PID == ev.PID && (ev.GUID == "" || p.GUID == ev.GUID) {
+					p.MayHaveExited = false
+				}
+			}
+		}
+	}
+
+	state.Processes = make([]StateProcess, 0, len(running))
+	for _, p := range running {
+		state.Processes = append(state.Processes, *p)
+	}
+	slices.SortFunc(state.Processes, func(a, b StateProcess) int { return cmp.Compare(a.PID, b.PID) })
+	linkParents(state.Processes)
+
+	if err := s.attachConnections(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// processEvents reads the process start and exit events from from up to
+// to, a page of the query limit at a time. It reports whether some were left
+// unread, which only happens when a whole page shares one timestamp.
+func (s *Scanner) processEvents(from, to time.Time) ([]scanstore.Record, bool, error) {
+	var events []scanstore.Record
+	skip := 0
+	for {
+		page, err := s.store.Query(scanstore.Query{
+			From:  from,
+			To:    to,
+			Kind:  scanstore.KindEvent,
+			Types: []string{EventProcessStart, EventProcessExit},
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		events = append(events, page.Records[min(skip, len(page.Records)):]...)
+		if !page.Truncated {
+			return events, false, nil
+		}
+
+		// The next page starts at the time of the last event, skipping the
+		// events at that time already read.
+		last := page.Records[len(page.Records)-1].Time
+		if last.Equal(from) {
+			return events, true, nil
+		}
+		from, skip = last, 0
+		for _, record := range page.Records {
+			if record.Time.Equal(last) {
+				skip++
+			}
+		}
+	}
+}
+
+// linkParents points every process at the running process with its parent
+// PID that started no later than it did.
+func linkParents(processes []StateProcess) {
+	byPID := make(map[int32]*StateProcess, len(processes))
+	for i := range processes {
+		byPID[processes[i].PID] = &processes[i]
+	}
+	for i := range processes {
+		p := &processes[i]
+		parent, ok := byPID[p.PPID]
+		if !ok || parent.PID == p.PID || parent.StartTime.After(p.StartTime) {
+			continue
+		}
+		p.Parent = &ProcessRef{PID: parent.PID, Name: parent.Name, ExePath: parent.ExePath, GUID: parent.GUID}
+	}
+}
+
+// attachConnections adds the connections of the latest connection snapshot
+// at or before the requested moment to the processes that owned them.
+func (s *Scanner) attachConnections(state *HostState) error {
+	records, err := s.store.SnapshotBefore(SnapshotConnection, state.At)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	state.ConnectionsAt = &records[0].Time
+
+	index := make(map[int32]int, len(state.Processes))
+	for i, p := range state.Processes {
+		index[p.PID] = i
+	}
+	for _, c := range decodeRecords[ConnectionInfo](records) {
+		if i, ok := index[c.PID]; ok && c.PID != 0 {
+			state.Processes[i].Connections = append(state.Processes[i].Connections, c)
+		} else {
+			state.UnownedConnections = append(state.UnownedConnections, c)
+		}
+	}
+	return nil
+}
+
+// processKey identifies a process across snapshots and events. Processes
+// that vanished before their GUID was known fall back to the PID.
+func processKey(guid string, pid int32) string {
+	if guid != "" {
+		return guid
+	}
+	return "pid:" + strconv.Itoa(int(pid))
+}
+
+func decodeRecords[T any](records []scanstore.Record) []T {
+	items := make([]T, 0, len(records))
+	for _, record := range records {
+		var item T
+		if err := json.Unmarshal(record.Data, &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,83 @@
+package agentScanner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// storeRecords adds records to the history store and waits until the last
+// of them, which carries pid, has been written.
+func storeRecords(t *testing.T, store *scanstore.Store, pid int32, records []scanstore.Record) {
+	t.Helper()
+	store.Add(records...)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if result, err := store.Query(scanstore.Query{PID: pid}); err == nil && len(result.Records) > 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("records up to pid %d were not written", pid)
+}
+
+func mustRecord(t *testing.T, kind, recordType string, at time.Time, data interface{}) scanstore.Record {
+	t.Helper()
+	record, ok := newRecord(kind, recordType, at, data)
+	if !ok {
+		t.Fatalf("failed to build %s record", recordType)
+	}
+	return record
+}
+
+func TestStateAtPagesThroughEvents(t *testing.T) {
+	s := newReplayScanner(t)
+	store, err := scanstore.Open(&models.HistoryStore{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer store.Close()
+	s.SetHistoryStore(store)
+
+	base := time.Now().Add(-time.Hour)
+	snapshot := mustRecord(t, scanstore.KindSnapshot, SnapshotProcess, base, ProcessInfo{PID: 1, Name: "init", StartTime: base.Add(-time.Hour)})
+	storeRecords(t, store, 1, []scanstore.Record{snapshot})
+
+	// More exits than one query returns come before the start event.
+	const exits = models.MaxHistoryQueryLimit + 10
+	const batch = 5000
+	for first := 0; first < exits; first += batch {
+		var records []scanstore.Record
+		for i := first; i < min(first+batch, exits); i++ {
+			at := base.Add(time.Duration(i+1) * time.Microsecond)
+			records = append(records, mustRecord(t, scanstore.KindEvent, EventProcessExit, at, ProcessEvent{Type: EventProcessExit, PID: int32(1000 + i), Time: at}))
+		}
+		storeRecords(t, store, int32(1000+len(records)+first-1), records)
+	}
+	started := base.Add(time.Minute)
+	start := ProcessEvent{Type: EventProcessStart, PID: 42, PPID: 1, Name: "late", Time: started}
+	storeRecords(t, store, 42, []scanstore.Record{mustRecord(t, scanstore.KindEvent, EventProcessStart, started, start)})
+
+	state, err := s.StateAt(started.Add(time.Second))
+	if err != nil {
+		t.Fatalf("StateAt: %v", err)
+	}
+	if state.Truncated {
+		t.Error("state is truncated although every event could be read")
+	}
+	found := false
+	for _, p := range state.Processes {
+		if p.PID == 42 {
+			found = true
+			if p.Parent == nil || p.Parent.PID != 1 {
+				t.Errorf("late process parent = %+v, want init", p.Parent)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("process started after the first page of events is missing: %+v", state.Processes)
+	}
+}
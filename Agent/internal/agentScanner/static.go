@@ -0,0 +1,76 @@
+package agentScanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/bhaiFi/security-monitor/internal/fileanalysis"
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// analysisCache keeps the static analysis of each binary by path, hash and
+// attributes, so an unchanged executable is analyzed once rather than on
+// every scan. The path and attributes are part of the key because some
+// traits depend on where the file is and on its setuid bits and
+// capabilities. Files that are neither PE nor ELF are kept as nil.
+type analysisCache struct {
+	entries map[string]*fileanalysis.Analysis
+	mu      sync.Mutex
+}
+
+func newAnalysisCache() *analysisCache {
+	return &analysisCache{entries: make(map[string]*fileanalysis.Analysis)}
+}
+
+func analysisKey(path, sha256 string) string {
+	return path + "|" + sha256 + "|" + fileanalysis.Attributes(path)
+}
+
+func (c *analysisCache) get(key string) (*fileanalysis.Analysis, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	analysis, ok := c.entries[key]
+	return analysis, ok
+}
+
+func (c *analysisCache) put(key string, analysis *fileanalysis.Analysis) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= models.MaxStaticAnalyses {
+		c.entries = make(map[string]*fileanalysis.Analysis)
+	}
+	c.entries[key] = analysis
+}
+
+func (s *Scanner) staticAnalysisEnabled() bool {
+	return s.config.StaticAnalysis != nil && s.config.StaticAnalysis.Enabled
+}
+
+// analyzeExecutable runs the static analysis on an inspected executable,
+// unless it is too large or could not be hashed.
+func (s *Scanner) analyzeExecutable(ctx context.Context, exe string, file *exeFile) *fileanalysis.Analysis {
+	maxSizeMB := s.config.StaticAnalysis.MaxFileSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = models.DefaultMaxFileSizeMB
+	}
+	if !file.hashed || file.size > maxSizeMB*1024*1024 {
+		return nil
+	}
+	key := analysisKey(exe, file.sha256)
+	if analysis, ok := s.analyses.get(key); ok {
+		return analysis
+	}
+
+	analysis, err := fileanalysis.Analyze(exe, s.governor.Throttle(ctx))
+	if err != nil && !errors.Is(err, fileanalysis.ErrUnsupportedFormat) {
+		logger.LogError("agentScanner.analyzeExecutable", "Static analysis failed", exe, err)
+		return nil
+	}
+	if analysis != nil && len(analysis.Traits) > 0 {
+		logger.LogInfo("agentScanner.analyzeExecutable", "[Suspicious] Executable has suspicious traits", exe, analysis.Traits)
+	}
+	s.analyses.put(key, analysis)
+	return analysis
+}
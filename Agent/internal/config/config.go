@@ -21,5 +21,7 @@ func LoadConfig(path string) (*models.Config, error) {
 		return nil, err
 	}
 
+	applyInstallerOverrides(&cfg)
+
 	return &cfg, nil
 }
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package config
+
+import "github.com/bhaiFi/security-monitor/pkg/models"
+
+// applyInstallerOverrides is a no-op where there is no MSI installer registry key.
+func applyInstallerOverrides(cfg *models.Config) {}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package config
+
+import (
+	"strconv"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"golang.org/x/sys/windows/registry"
+)
+
+// installerKey is written by the MSI installer from its command line properties.
+const installerKey = `Software\BhaiFi\BhaiFi_Agent`
+
+// applyInstallerOverrides lets the installer's TIME_INTERVAL property take
+// precedence over monitor.interval_seconds from the config file.
+func applyInstallerOverrides(cfg *models.Config) {
+	// The installer is 32-bit, so its key lives in the WOW6432Node view.
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, installerKey, registry.QUERY_VALUE|registry.WOW64_32KEY)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+
+	value, _, err := key.GetStringValue("TimeInterval")
+	if err != nil || value == "" {
+		return
+	}
+
+	interval, err := strconv.Atoi(value)
+	if err != nil || interval <= 0 {
+		logger.LogWarning("LoadConfig", "ignoring invalid installer TimeInterval", value, err)
+		return
+	}
+	if cfg.Monitor != nil {
+		cfg.Monitor.IntervalSeconds = interval
+	}
+}
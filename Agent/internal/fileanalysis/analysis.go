@@ -0,0 +1,340 @@
+package fileanalysis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Executable formats reported in Analysis.Format.
+const (
+	FormatPE  = "pe"
+	FormatELF = "elf"
+)
+
+// Suspicious traits reported in Trait.Name.
+const (
+	TraitPacked             = "packed"
+	TraitHighEntropy        = "highEntropy"
+	TraitWritableExecutable = "writableExecutable"
+	TraitEntryOutsideText   = "entryOutsideText"
+	TraitOverlay            = "overlay"
+	TraitNoImports          = "noImports"
+)
+
+// HighEntropy is the entropy, in bits per byte, above which executable code
+// is taken to be compressed or encrypted. Compiled code rarely exceeds 6.8.
+const HighEntropy = 7.2
+
+// signatureWindow is how much of the start and end of a file is searched
+// for packer signatures.
+const signatureWindow = 8192
+
+// ErrUnsupportedFormat is returned for files that are neither PE nor ELF.
+var ErrUnsupportedFormat = errors.New("not a PE or ELF file")
+
+// Analysis is what the static analysis learned about an executable.
+// EntrySection is empty when the entry point is in no section. PE and ELF
+// hold the metadata of the format.
+type Analysis struct {
+	Format       string    `json:"format"`
+	Size         int64     `json:"size"`
+	Entropy      float64   `json:"entropy"`
+	EntryPoint   uint64    `json:"entryPoint"`
+	EntrySection string    `json:"entrySection,omitempty"`
+	Sections     []Section `json:"sections"`
+	Imports      int       `json:"imports"`
+	Packers      []string  `json:"packers,omitempty"`
+	Overlay      *Overlay  `json:"overlay,omitempty"`
+	Traits       []Trait   `json:"traits,omitempty"`
+	PE           *PEInfo   `json:"pe,omitempty"`
+	ELF          *ELFInfo  `json:"elf,omitempty"`
+}
+
+// Section is a PE or ELF section. Offset and Size locate its data in the
+// file; Address and VirtualSize locate it in memory.
+type Section struct {
+	Name        string  `json:"name"`
+	Address     uint64  `json:"address"`
+	VirtualSize uint64  `json:"virtualSize"`
+	Offset      uint64  `json:"offset"`
+	Size        uint64  `json:"size"`
+	Entropy     float64 `json:"entropy"`
+	Writable    bool    `json:"writable"`
+	Executable  bool    `json:"executable"`
+}
+
+// Overlay is data appended after the end of the image, such as an
+// installer payload. The certificate table of a signed PE is not overlay.
+type Overlay struct {
+	Offset  int64   `json:"offset"`
+	Size    int64   `json:"size"`
+	Entropy float64 `json:"entropy"`
+}
+
+// Trait is a suspicious property of an executable.
+type Trait struct {
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+}
+
+// HasTrait reports whether the analysis flagged the named trait.
+func (a *Analysis) HasTrait(name string) bool {
+	return slices.ContainsFunc(a.Traits, func(t Trait) bool { return t.Name == name })
+}
+
+func (a *Analysis) flag(name, format string, args ...interface{}) {
+	a.Traits = append(a.Traits, Trait{Name: name, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Throttle is called before every read of n bytes and may delay it. An
+// error fails the read.
+type Throttle func(n int) error
+
+// throttledReader applies a Throttle to the reads of a file.
+type throttledReader struct {
+	r        io.ReaderAt
+	throttle Throttle
+}
+
+func (t throttledReader) ReadAt(p []byte, off int64) (int, error) {
+	if err := t.throttle(len(p)); err != nil {
+		return 0, err
+	}
+	return t.r.ReadAt(p, off)
+}
+
+// Analyze parses the PE or ELF file at path. Reads of the file go through
+// throttle, if set. The parsers can panic on malformed files, which is
+// reported as an error.
+func Analyze(path string, throttle Throttle) (analysis *Analysis, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			analysis, err = nil, fmt.Errorf("failed to parse %s: %v", path, r)
+		}
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	var r io.ReaderAt = f
+	if throttle != nil {
+		r = throttledReader{r: f, throttle: throttle}
+	}
+
+	a := &Analysis{Size: info.Size(), Format: Sniff(f)}
+	switch a.Format {
+	case FormatPE:
+		err = analyzePE(r, a)
+	case FormatELF:
+		err = analyzeELF(r, a)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Entropy, err = entropy(io.NewSectionReader(r, 0, a.Size)); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := a.checkCommon(r); err != nil {
+		return nil, err
+	}
+	if a.PE != nil {
+		a.PE.checkNames(path)
+	}
+	if a.ELF != nil {
+		a.checkELF(path, info.Mode())
+	}
+	return a, nil
+}
+
+// Attributes summarizes what the traits depend on besides the content and
+// path of a file: its setuid and setgid bits and its file capabilities. A
+// cached analysis is stale once they change.
+func Attributes(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	caps, _ := fileCapabilities(path)
+	return fmt.Sprintf("%o:%x", info.Mode()&(fs.ModeSetuid|fs.ModeSetgid), caps)
+}
+
+// Sniff returns the executable format of the data by its magic number, or
+// an empty string if it is neither PE nor ELF.
+func Sniff(r io.Reader) string {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return ""
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		return FormatPE
+	case bytes.Equal(magic, []byte("\x7fELF")):
+		return FormatELF
+	}
+	return ""
+}
+
+// checkCommon runs the checks that work the same for PE and ELF once the
+// format parser has filled in the sections, entry point and overlay.
+func (a *Analysis) checkCommon(r io.ReaderAt) error {
+	for _, s := range a.Sections {
+		if s.Writable && s.Executable {
+			a.flag(TraitWritableExecutable, "section %s is writable and executable", s.Name)
+		}
+		if s.Executable && s.Entropy >= HighEntropy {
+			a.flag(TraitHighEntropy, "executable section %s has entropy %.2f", s.Name, s.Entropy)
+		}
+		if packer := packerSection(s.Name); packer != "" {
+			a.addPacker(packer)
+		}
+	}
+
+	if a.EntryPoint != 0 && a.EntrySection != ".text" {
+		if a.EntrySection == "" {
+			a.flag(TraitEntryOutsideText, "entry point 0x%x is outside every section", a.EntryPoint)
+		} else {
+			a.flag(TraitEntryOutsideText, "entry point 0x%x is in section %s", a.EntryPoint, a.EntrySection)
+		}
+	}
+
+	if a.Overlay != nil {
+		overlay := io.NewSectionReader(r, a.Overlay.Offset, a.Overlay.Size)
+		var err error
+		if a.Overlay.Entropy, err = entropy(overlay); err != nil {
+			return fmt.Errorf("failed to read overlay: %w", err)
+		}
+		a.flag(TraitOverlay, "%d bytes appended at offset 0x%x", a.Overlay.Size, a.Overlay.Offset)
+	}
+
+	signatures, err := packerSignatures(r, a.Size)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	for _, packer := range signatures {
+		a.addPacker(packer)
+	}
+	if len(a.Packers) > 0 {
+		a.flag(TraitPacked, "packed with %s", strings.Join(a.Packers, ", "))
+	}
+	return nil
+}
+
+func (a *Analysis) addPacker(packer string) {
+	if !slices.Contains(a.Packers, packer) {
+		a.Packers = append(a.Packers, packer)
+	}
+}
+
+// packerSection names the packer that creates a section name.
+func packerSection(name string) string {
+	switch strings.ToLower(strings.TrimRight(name, "\x00")) {
+	case "upx0", "upx1", "upx2", "upx3", ".upx0", ".upx1", ".upx2":
+		return "UPX"
+	case ".mpress1", ".mpress2", "mpress1", "mpress2":
+		return "MPRESS"
+	case ".themida", "themida", ".winlice", "winlicen":
+		return "Themida"
+	}
+	return ""
+}
+
+// packerMarkers are left in the stub and trailer of packed files. MPRESS
+// and Themida are recognized by their section names instead.
+var packerMarkers = []struct {
+	packer string
+	marker []byte
+}{
+	{"UPX", []byte("UPX!")},
+}
+
+// packerSignatures searches the start and end of a file for packer markers.
+// UPX keeps its marker there even when it strips the section names.
+func packerSignatures(r io.ReaderAt, size int64) ([]string, error) {
+	windows := [][2]int64{{0, min(size, signatureWindow)}}
+	if size > signatureWindow {
+		start := max(size-signatureWindow, signatureWindow)
+		windows = append(windows, [2]int64{start, size - start})
+	}
+
+	var found []string
+	for _, w := range windows {
+		data := make([]byte, w[1])
+		if _, err := r.ReadAt(data, w[0]); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		for _, m := range packerMarkers {
+			if bytes.Contains(data, m.marker) && !slices.Contains(found, m.packer) {
+				found = append(found, m.packer)
+			}
+		}
+	}
+	return found, nil
+}
+
+// entropy is the Shannon entropy of the data in bits per byte, from 0 for
+// a single repeated byte to 8 for random data.
+func entropy(r io.Reader) (float64, error) {
+	var counts [256]int64
+	var total int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+		total += int64(n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	var bits float64
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(total)
+			bits -= p * math.Log2(p)
+		}
+	}
+	return math.Round(bits*1000) / 1000, nil
+}
+
+// sectionEntropy is the entropy of size bytes at offset, clamped to the file.
+func sectionEntropy(r io.ReaderAt, fileSize int64, offset, size uint64) (float64, error) {
+	if offset >= uint64(fileSize) || size == 0 {
+		return 0, nil
+	}
+	size = min(size, uint64(fileSize)-offset)
+	return entropy(io.NewSectionReader(r, int64(offset), int64(size)))
+}
+
+// overlayAfter returns the data between end and the end of the file, if any.
+func overlayAfter(end uint64, fileSize int64) *Overlay {
+	if end >= uint64(fileSize) {
+		return nil
+	}
+	return &Overlay{Offset: int64(end), Size: fileSize - int64(end)}
+}
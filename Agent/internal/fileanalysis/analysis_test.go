@@ -0,0 +1,34 @@
+package fileanalysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyzeRecoversFromPanics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, append([]byte("\x7fELF"), make([]byte, 60)...), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The throttle sees every read, so a panic in it stands in for one in
+	// the parsers.
+	analysis, err := Analyze(path, func(int) error { panic("malformed") })
+	if err == nil {
+		t.Fatal("expected an error for a panicking parse")
+	}
+	if analysis != nil {
+		t.Errorf("analysis = %+v, want nil", analysis)
+	}
+}
+
+func TestAnalyzeUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("plain text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Analyze(path, nil); err != ErrUnsupportedFormat {
+		t.Errorf("err = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
@@ -0,0 +1,83 @@
+package fileanalysis
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+)
+
+// analyzeELF fills in the sections, entry point, imports, overlay and
+// metadata of an ELF.
+func analyzeELF(r io.ReaderAt, a *Analysis) error {
+	ef, err := elf.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("failed to parse ELF: %w", err)
+	}
+	defer ef.Close()
+
+	a.EntryPoint = ef.Entry
+	end := sectionTableEnd(r, ef)
+	for _, s := range ef.Sections {
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+		section := Section{
+			Name:        s.Name,
+			Address:     s.Addr,
+			VirtualSize: s.Size,
+			Offset:      s.Offset,
+			Writable:    s.Flags&elf.SHF_WRITE != 0,
+			Executable:  s.Flags&elf.SHF_EXECINSTR != 0,
+		}
+		if s.Type != elf.SHT_NOBITS {
+			section.Size = s.FileSize
+			if section.Entropy, err = sectionEntropy(r, a.Size, section.Offset, section.Size); err != nil {
+				return fmt.Errorf("failed to read section %s: %w", s.Name, err)
+			}
+			end = max(end, section.Offset+section.Size)
+		}
+		if s.Flags&elf.SHF_ALLOC != 0 && a.EntryPoint >= s.Addr && a.EntryPoint < s.Addr+s.Size {
+			a.EntrySection = s.Name
+		}
+		a.Sections = append(a.Sections, section)
+	}
+
+	for _, p := range ef.Progs {
+		end = max(end, p.Off+p.Filesz)
+		// Packers that strip the section headers still need a writable and
+		// executable segment to unpack into.
+		if p.Type == elf.PT_LOAD && p.Flags&elf.PF_W != 0 && p.Flags&elf.PF_X != 0 {
+			a.flag(TraitWritableExecutable, "segment at 0x%x is writable and executable", p.Vaddr)
+		}
+	}
+	a.Overlay = overlayAfter(end, a.Size)
+
+	if symbols, err := ef.ImportedSymbols(); err == nil {
+		a.Imports = len(symbols)
+	}
+	a.ELF = elfMetadata(r, ef)
+	return nil
+}
+
+// sectionTableEnd returns where the section header table ends, which
+// debug/elf does not expose. It is usually the last thing in the file.
+func sectionTableEnd(r io.ReaderAt, ef *elf.File) uint64 {
+	header := make([]byte, 64)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return 0
+	}
+	order := ef.ByteOrder
+	var offset uint64
+	var entrySize, count uint16
+	if ef.Class == elf.ELFCLASS64 {
+		offset = order.Uint64(header[0x28:])
+		entrySize, count = order.Uint16(header[0x3a:]), order.Uint16(header[0x3c:])
+	} else {
+		offset = uint64(order.Uint32(header[0x20:]))
+		entrySize, count = order.Uint16(header[0x2e:]), order.Uint16(header[0x30:])
+	}
+	if offset == 0 {
+		return 0
+	}
+	return offset + uint64(entrySize)*uint64(count)
+}
@@ -0,0 +1,230 @@
+package fileanalysis
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ELF traits reported in Trait.Name, besides the ones shared with PE.
+const (
+	TraitWritableRPath      = "writableRpath"
+	TraitUnusualInterpreter = "unusualInterpreter"
+	TraitStaticInUserDir    = "staticInUserDir"
+	TraitSetuid             = "setuid"
+	TraitFileCapabilities   = "fileCapabilities"
+)
+
+// ntGNUBuildID is the type of the GNU build-id note.
+const ntGNUBuildID = 3
+
+// ELFInfo is the metadata of an ELF file. Static is set for executables
+// without an interpreter or needed libraries, Stripped for files without a
+// symbol table. Capabilities are the file capabilities in getcap notation.
+type ELFInfo struct {
+	Class        string   `json:"class"`
+	Machine      string   `json:"machine"`
+	Type         string   `json:"type"`
+	Interpreter  string   `json:"interpreter,omitempty"`
+	Needed       []string `json:"needed,omitempty"`
+	RPath        []string `json:"rpath,omitempty"`
+	RunPath      []string `json:"runpath,omitempty"`
+	BuildID      string   `json:"buildId,omitempty"`
+	Static       bool     `json:"static"`
+	Stripped     bool     `json:"stripped"`
+	Setuid       bool     `json:"setuid"`
+	Setgid       bool     `json:"setgid"`
+	Capabilities string   `json:"capabilities,omitempty"`
+}
+
+var (
+	// interpreterDirs are where the dynamic loader is installed.
+	interpreterDirs = []string{"/lib/", "/lib32/", "/lib64/", "/libx32/", "/usr/lib/", "/usr/lib32/", "/usr/lib64/", "/usr/libx32/", "/nix/store/"}
+	// systemDirs are where setuid binaries and binaries with file
+	// capabilities are installed by the distribution.
+	systemDirs = []string{"/bin/", "/sbin/", "/usr/bin/", "/usr/sbin/", "/usr/lib/", "/usr/lib64/", "/usr/libexec/", "/lib/", "/lib64/", "/usr/local/bin/", "/usr/local/sbin/", "/snap/"}
+	// userDirs are home directories and directories anyone may write to.
+	userDirs = []string{"/home/", "/root/", "/tmp/", "/var/tmp/", "/dev/shm/", "/run/user/"}
+)
+
+// elfMetadata reads the dynamic section, build-id and symbol table.
+func elfMetadata(r io.ReaderAt, ef *elf.File) *ELFInfo {
+	info := &ELFInfo{
+		Class:    "elf" + strings.TrimPrefix(ef.Class.String(), "ELFCLASS"),
+		Machine:  strings.ToLower(strings.TrimPrefix(ef.Machine.String(), "EM_")),
+		Type:     strings.ToLower(strings.TrimPrefix(ef.Type.String(), "ET_")),
+		Stripped: ef.Section(".symtab") == nil,
+	}
+
+	for _, p := range ef.Progs {
+		switch p.Type {
+		case elf.PT_INTERP:
+			data := make([]byte, min(p.Filesz, 4096))
+			if _, err := r.ReadAt(data, int64(p.Off)); err == nil {
+				interpreter, _, _ := bytes.Cut(data, []byte{0})
+				info.Interpreter = string(interpreter)
+			}
+		case elf.PT_NOTE:
+			if info.BuildID == "" {
+				info.BuildID = buildID(io.NewSectionReader(r, int64(p.Off), int64(p.Filesz)), ef.ByteOrder)
+			}
+		}
+	}
+	if section := ef.Section(".note.gnu.build-id"); info.BuildID == "" && section != nil {
+		info.BuildID = buildID(section.Open(), ef.ByteOrder)
+	}
+
+	info.Needed, _ = ef.ImportedLibraries()
+	info.RPath = dynamicPaths(ef, elf.DT_RPATH)
+	info.RunPath = dynamicPaths(ef, elf.DT_RUNPATH)
+	// Static position-independent executables are ET_DYN like shared
+	// libraries, but have an entry point.
+	executable := ef.Type == elf.ET_EXEC || (ef.Type == elf.ET_DYN && ef.Entry != 0)
+	info.Static = executable && info.Interpreter == "" && len(info.Needed) == 0
+	return info
+}
+
+func dynamicPaths(ef *elf.File, tag elf.DynTag) []string {
+	values, err := ef.DynString(tag)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, value := range values {
+		paths = append(paths, strings.Split(value, ":")...)
+	}
+	return paths
+}
+
+// buildID finds the GNU build-id among the notes read from r. Notes are a
+// name size, a descriptor size and a type, followed by the name and the
+// descriptor, each padded to four bytes.
+func buildID(r io.Reader, order binary.ByteOrder) string {
+	data, err := io.ReadAll(io.LimitReader(r, 64*1024))
+	if err != nil {
+		return ""
+	}
+	for len(data) >= 12 {
+		nameSize := int(order.Uint32(data[0:]))
+		descSize := int(order.Uint32(data[4:]))
+		noteType := order.Uint32(data[8:])
+		nameEnd := 12 + align4(nameSize)
+		descEnd := nameEnd + align4(descSize)
+		if nameSize < 0 || descSize < 0 || nameEnd+descSize > len(data) {
+			return ""
+		}
+		name := string(bytes.TrimRight(data[12:12+nameSize], "\x00"))
+		if noteType == ntGNUBuildID && name == "GNU" {
+			return hex.EncodeToString(data[nameEnd : nameEnd+descSize])
+		}
+		data = data[min(descEnd, len(data)):]
+	}
+	return ""
+}
+
+// checkELF reads the setuid bits and file capabilities and flags the traits
+// that depend on where the file is.
+func (a *Analysis) checkELF(path string, mode fs.FileMode) {
+	info := a.ELF
+	info.Setuid = mode&fs.ModeSetuid != 0
+	info.Setgid = mode&fs.ModeSetgid != 0
+	if data, err := fileCapabilities(path); err == nil && len(data) > 0 {
+		info.Capabilities = formatCapabilities(data)
+	}
+
+	for _, dirs := range [][]string{info.RPath, info.RunPath} {
+		for _, dir := range dirs {
+			if !strings.HasPrefix(dir, "/") && !strings.HasPrefix(dir, "$ORIGIN") {
+				a.flag(TraitWritableRPath, "library search path %q is relative to the working directory", dir)
+			} else if hasPrefix(dir+"/", userDirs) {
+				a.flag(TraitWritableRPath, "library search path %s is user-writable", dir)
+			}
+		}
+	}
+	if info.Interpreter != "" && !hasPrefix(info.Interpreter, interpreterDirs) {
+		a.flag(TraitUnusualInterpreter, "loaded by %s", info.Interpreter)
+	}
+
+	path = filepath.ToSlash(path)
+	if info.Static && hasPrefix(path, userDirs) {
+		a.flag(TraitStaticInUserDir, "statically linked binary in a user-writable directory")
+	}
+	if !hasPrefix(path, systemDirs) {
+		if info.Setuid || info.Setgid {
+			a.flag(TraitSetuid, "setuid or setgid binary outside the system directories")
+		}
+		if info.Capabilities != "" {
+			a.flag(TraitFileCapabilities, "file capabilities %s outside the system directories", info.Capabilities)
+		}
+	}
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilityNames are the Linux capabilities by bit number.
+var capabilityNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill", "setgid", "setuid",
+	"setpcap", "linux_immutable", "net_bind_service", "net_broadcast", "net_admin", "net_raw",
+	"ipc_lock", "ipc_owner", "sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time", "sys_tty_config", "mknod",
+	"lease", "audit_write", "audit_control", "setfcap", "mac_override", "mac_admin", "syslog",
+	"wake_alarm", "block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+// formatCapabilities turns a security.capability attribute into getcap
+// notation, such as "cap_net_raw,cap_net_admin=ep". The attribute is a
+// little-endian vfs_cap_data: a revision and flags word followed by pairs
+// of permitted and inheritable masks, the low 32 bits first.
+func formatCapabilities(data []byte) string {
+	if len(data) < 12 {
+		return ""
+	}
+	effective := binary.LittleEndian.Uint32(data[0:])&1 != 0
+	permitted := uint64(binary.LittleEndian.Uint32(data[4:]))
+	inheritable := uint64(binary.LittleEndian.Uint32(data[8:]))
+	if len(data) >= 20 {
+		permitted |= uint64(binary.LittleEndian.Uint32(data[12:])) << 32
+		inheritable |= uint64(binary.LittleEndian.Uint32(data[16:])) << 32
+	}
+
+	var parts []string
+	if permitted != 0 {
+		flags := "p"
+		if effective {
+			flags = "ep"
+		}
+		parts = append(parts, capabilityList(permitted)+"="+flags)
+	}
+	if inheritable != 0 {
+		parts = append(parts, capabilityList(inheritable)+"=i")
+	}
+	return strings.Join(parts, " ")
+}
+
+func capabilityList(mask uint64) string {
+	var names []string
+	for bit := 0; bit < 64; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+		if bit < len(capabilityNames) {
+			names = append(names, "cap_"+capabilityNames[bit])
+		} else {
+			names = append(names, fmt.Sprintf("cap_%d", bit))
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,91 @@
+package fileanalysis
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// certificateAlignment is the padding allowed between the last section and
+// the certificate table of a signed PE.
+const certificateAlignment = 8
+
+// coffSymbolSize is the size of a COFF symbol table entry.
+const coffSymbolSize = 18
+
+// analyzePE fills in the sections, entry point, imports, overlay and
+// metadata of a PE.
+func analyzePE(r io.ReaderAt, a *Analysis) error {
+	pf, err := pe.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("failed to parse PE: %w", err)
+	}
+	defer pf.Close()
+
+	var dirs []pe.DataDirectory
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		a.EntryPoint = uint64(oh.AddressOfEntryPoint)
+		dirs = oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, uint32(len(oh.DataDirectory)))]
+	case *pe.OptionalHeader64:
+		a.EntryPoint = uint64(oh.AddressOfEntryPoint)
+		dirs = oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, uint32(len(oh.DataDirectory)))]
+	}
+
+	var end uint64
+	for _, s := range pf.Sections {
+		section := Section{
+			Name:        s.Name,
+			Address:     uint64(s.VirtualAddress),
+			VirtualSize: uint64(s.VirtualSize),
+			Offset:      uint64(s.Offset),
+			Size:        uint64(s.Size),
+			Writable:    s.Characteristics&pe.IMAGE_SCN_MEM_WRITE != 0,
+			Executable:  s.Characteristics&pe.IMAGE_SCN_MEM_EXECUTE != 0,
+		}
+		if section.Entropy, err = sectionEntropy(r, a.Size, section.Offset, section.Size); err != nil {
+			return fmt.Errorf("failed to read section %s: %w", s.Name, err)
+		}
+		if s.Size > 0 {
+			end = max(end, section.Offset+section.Size)
+		}
+		mapped := max(section.VirtualSize, section.Size)
+		if a.EntryPoint >= section.Address && a.EntryPoint < section.Address+mapped {
+			a.EntrySection = section.Name
+		}
+		a.Sections = append(a.Sections, section)
+	}
+
+	// MinGW keeps a COFF symbol table and its string table after the
+	// sections. The string table starts with its own length.
+	if symbols := uint64(pf.FileHeader.PointerToSymbolTable); symbols > 0 {
+		stringTable := symbols + uint64(pf.FileHeader.NumberOfSymbols)*coffSymbolSize
+		length := make([]byte, 4)
+		if _, err := r.ReadAt(length, int64(stringTable)); err == nil {
+			end = max(end, stringTable+uint64(binary.LittleEndian.Uint32(length)))
+		}
+	}
+
+	// The certificate table is addressed by file offset and follows the
+	// sections of a signed file, so anything after it is the overlay.
+	if len(dirs) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+		cert := dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		start := uint64(cert.VirtualAddress)
+		if cert.Size > 0 && start >= end && start-end < certificateAlignment {
+			end = start + uint64(cert.Size)
+		}
+	}
+	a.Overlay = overlayAfter(end, a.Size)
+
+	symbols, err := pf.ImportedSymbols()
+	if err == nil {
+		a.Imports = len(symbols)
+	}
+	a.PE = peMetadata(pf, dirs, symbols)
+	// Resource-only DLLs have neither code nor imports.
+	if a.Imports == 0 && a.EntryPoint != 0 {
+		a.flag(TraitNoImports, "no imported functions; imports are likely resolved at run time")
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package fileanalysis
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Mismatches reported in PEInfo.Mismatches.
+const (
+	MismatchOriginalFilename = "originalFilename"
+	MismatchExportName       = "exportName"
+	MismatchExtension        = "extension"
+	MismatchCompanyName      = "companyName"
+)
+
+const (
+	// rtVersion is the resource type of the version resource.
+	rtVersion = 16
+	// maxExports bounds the export names read from one file.
+	maxExports = 10000
+	// maxVersionSize bounds the version resource read from one file.
+	maxVersionSize = 64 * 1024
+)
+
+// PEInfo is the metadata of a PE file. Version holds the strings of the
+// version resource, such as CompanyName, OriginalFilename and
+// ProductVersion. Mismatches are where the metadata contradicts the file.
+type PEInfo struct {
+	Machine    string            `json:"machine"`
+	Subsystem  string            `json:"subsystem"`
+	Timestamp  time.Time         `json:"timestamp"`
+	DLL        bool              `json:"dll"`
+	Version    map[string]string `json:"version,omitempty"`
+	Imports    []Import          `json:"imports,omitempty"`
+	ExportName string            `json:"exportName,omitempty"`
+	Exports    []string          `json:"exports,omitempty"`
+	Mismatches []Trait           `json:"mismatches,omitempty"`
+}
+
+// Import is a library a PE file imports and the functions it imports by name.
+type Import struct {
+	Library   string   `json:"library"`
+	Functions []string `json:"functions"`
+}
+
+var machineNames = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "i386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_ARM:   "arm",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	pe.IMAGE_FILE_MACHINE_IA64:  "ia64",
+}
+
+var subsystemNames = map[uint16]string{
+	pe.IMAGE_SUBSYSTEM_NATIVE:                   "native",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:              "windowsGui",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:              "windowsConsole",
+	pe.IMAGE_SUBSYSTEM_POSIX_CUI:                "posixConsole",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI:           "windowsCeGui",
+	pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:          "efiApplication",
+	pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER:  "efiBootServiceDriver",
+	pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER:       "efiRuntimeDriver",
+	pe.IMAGE_SUBSYSTEM_XBOX:                     "xbox",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION: "windowsBootApplication",
+}
+
+// peMetadata reads the headers, version resource, imports and exports.
+func peMetadata(pf *pe.File, dirs []pe.DataDirectory, symbols []string) *PEInfo {
+	info := &PEInfo{
+		Machine:   machineNames[pf.Machine],
+		Timestamp: time.Unix(int64(pf.TimeDateStamp), 0).UTC(),
+		DLL:       pf.Characteristics&pe.IMAGE_FILE_DLL != 0,
+	}
+	if info.Machine == "" {
+		info.Machine = fmt.Sprintf("0x%x", pf.Machine)
+	}
+	var subsystem uint16
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		subsystem = oh.Subsystem
+	case *pe.OptionalHeader64:
+		subsystem = oh.Subsystem
+	}
+	if info.Subsystem = subsystemNames[subsystem]; info.Subsystem == "" {
+		info.Subsystem = fmt.Sprintf("0x%x", subsystem)
+	}
+
+	// ImportedSymbols reports each import as function:library.
+	libraries := make(map[string]int)
+	for _, symbol := range symbols {
+		function, library, ok := strings.Cut(symbol, ":")
+		if !ok {
+			continue
+		}
+		i, seen := libraries[library]
+		if !seen {
+			i = len(info.Imports)
+			libraries[library] = i
+			info.Imports = append(info.Imports, Import{Library: library})
+		}
+		info.Imports[i].Functions = append(info.Imports[i].Functions, function)
+	}
+
+	image := imageReader{sections: pf.Sections}
+	if len(dirs) > pe.IMAGE_DIRECTORY_ENTRY_EXPORT {
+		info.ExportName, info.Exports = image.exports(dirs[pe.IMAGE_DIRECTORY_ENTRY_EXPORT])
+	}
+	if len(dirs) > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+		info.Version = image.version(dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE])
+	}
+	return info
+}
+
+// checkNames flags metadata naming the file differently from how it is
+// named on disk.
+func (p *PEInfo) checkNames(path string) {
+	name := filepath.Base(path)
+	if original := p.Version["OriginalFilename"]; original != "" {
+		// Language resource files carry the name of the file they localize.
+		original = strings.TrimSuffix(original, ".mui")
+		if !strings.EqualFold(original, name) {
+			p.mismatch(MismatchOriginalFilename, "version resource names the file %s, it is %s on disk", original, name)
+		}
+	}
+	if p.ExportName != "" && !strings.EqualFold(p.ExportName, name) {
+		p.mismatch(MismatchExportName, "export directory names the library %s, it is %s on disk", p.ExportName, name)
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case p.DLL && ext == ".exe":
+		p.mismatch(MismatchExtension, "file is a DLL but named %s", name)
+	case !p.DLL && ext == ".dll":
+		p.mismatch(MismatchExtension, "file is not a DLL but named %s", name)
+	}
+}
+
+// CheckSigner flags a version resource claiming a company that did not sign
+// the file. signer comes from the embedded signature or the catalog listing
+// the file. unsigned is only set when the platform verified the file has
+// neither, which stands out for files claiming to come from Microsoft; where
+// that cannot be checked an empty signer is not reported.
+func (p *PEInfo) CheckSigner(signer string, unsigned bool) {
+	company := strings.TrimSpace(p.Version["CompanyName"])
+	if company == "" {
+		return
+	}
+	words := strings.Fields(strings.ToLower(company))
+	switch {
+	case signer == "" && unsigned && words[0] == "microsoft":
+		p.mismatch(MismatchCompanyName, "claims to come from %s but is not signed", company)
+	case signer != "" && !strings.Contains(strings.ToLower(signer), words[0]):
+		p.mismatch(MismatchCompanyName, "claims to come from %s but is signed by %s", company, signer)
+	}
+}
+
+func (p *PEInfo) mismatch(name, format string, args ...interface{}) {
+	p.Mismatches = append(p.Mismatches, Trait{Name: name, Detail: fmt.Sprintf(format, args...)})
+}
+
+// imageReader reads a PE file by relative virtual address.
+type imageReader struct {
+	sections []*pe.Section
+}
+
+func (m imageReader) read(rva uint32, n int) ([]byte, error) {
+	for _, s := range m.sections {
+		if rva < s.VirtualAddress || rva >= s.VirtualAddress+max(s.VirtualSize, s.Size) {
+			continue
+		}
+		data := make([]byte, n)
+		if _, err := s.ReadAt(data, int64(rva-s.VirtualAddress)); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("address 0x%x is in no section", rva)
+}
+
+// cstring reads a NUL-terminated name of up to 256 bytes.
+func (m imageReader) cstring(rva uint32) string {
+	for n := 256; n > 0; n /= 4 {
+		if data, err := m.read(rva, n); err == nil {
+			name, _, _ := bytes.Cut(data, []byte{0})
+			return string(name)
+		}
+	}
+	return ""
+}
+
+// exports reads the library name and the exported function names from the
+// export directory.
+func (m imageReader) exports(dir pe.DataDirectory) (string, []string) {
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return "", nil
+	}
+	header, err := m.read(dir.VirtualAddress, 40)
+	if err != nil {
+		return "", nil
+	}
+	name := m.cstring(binary.LittleEndian.Uint32(header[12:]))
+	count := min(binary.LittleEndian.Uint32(header[24:]), maxExports)
+	table, err := m.read(binary.LittleEndian.Uint32(header[32:]), int(count)*4)
+	if err != nil {
+		return name, nil
+	}
+	exports := make([]string, 0, count)
+	for i := range int(count) {
+		exports = append(exports, m.cstring(binary.LittleEndian.Uint32(table[i*4:])))
+	}
+	return name, exports
+}
+
+// version finds the version resource and returns its strings.
+func (m imageReader) version(dir pe.DataDirectory) map[string]string {
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil
+	}
+	// The resource tree is indexed by type, then name, then language.
+	offset, err := m.resourceEntry(dir.VirtualAddress, 0, rtVersion)
+	for level := 0; level < 2 && err == nil; level++ {
+		offset, err = m.resourceEntry(dir.VirtualAddress, offset, -1)
+	}
+	if err != nil {
+		return nil
+	}
+
+	entry, err := m.read(dir.VirtualAddress+offset, 8)
+	if err != nil {
+		return nil
+	}
+	size := min(int(binary.LittleEndian.Uint32(entry[4:])), maxVersionSize)
+	data, err := m.read(binary.LittleEndian.Uint32(entry[0:]), size)
+	if err != nil {
+		return nil
+	}
+	return parseVersionInfo(data)
+}
+
+// resourceEntry looks up id, or takes the first entry if id is negative, in
+// the resource directory at offset and returns the offset of what it points
+// to. Offsets are relative to the start of the resource section.
+func (m imageReader) resourceEntry(base, offset uint32, id int) (uint32, error) {
+	header, err := m.read(base+offset, 16)
+	if err != nil {
+		return 0, err
+	}
+	count := int(binary.LittleEndian.Uint16(header[12:])) + int(binary.LittleEndian.Uint16(header[14:]))
+	entries, err := m.read(base+offset+16, count*8)
+	if err != nil {
+		return 0, err
+	}
+	for i := range count {
+		name := binary.LittleEndian.Uint32(entries[i*8:])
+		target := binary.LittleEndian.Uint32(entries[i*8+4:]) &^ 0x80000000
+		if id < 0 || (name&0x80000000 == 0 && name == uint32(id)) {
+			return target, nil
+		}
+	}
+	return 0, errors.New("resource not found")
+}
+
+// parseVersionInfo reads the StringFileInfo of a VS_VERSIONINFO resource.
+// Where several languages are present the first one wins.
+func parseVersionInfo(data []byte) map[string]string {
+	key, _, children, _, ok := versionBlock(data)
+	if !ok || key != "VS_VERSION_INFO" {
+		return nil
+	}
+	values := make(map[string]string)
+	for len(children) > 0 {
+		key, _, tables, next, ok := versionBlock(children)
+		if !ok {
+			break
+		}
+		if key == "StringFileInfo" {
+			for len(tables) > 0 {
+				_, _, strs, rest, ok := versionBlock(tables)
+				if !ok {
+					break
+				}
+				for len(strs) > 0 {
+					name, value, _, more, ok := versionBlock(strs)
+					if !ok {
+						break
+					}
+					if _, set := values[name]; !set && name != "" {
+						values[name] = utf16String(value)
+					}
+					strs = more
+				}
+				tables = rest
+			}
+		}
+		children = next
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// versionBlock splits the version resource block at the start of data into
+// its key, value and children, and returns the data after it. Blocks are
+// wLength, wValueLength, wType, a NUL-terminated UTF-16 key, the value and
+// the children, each aligned to four bytes. Text values are measured in
+// UTF-16 characters rather than bytes.
+func versionBlock(data []byte) (key string, value, children, next []byte, ok bool) {
+	if len(data) < 6 {
+		return "", nil, nil, nil, false
+	}
+	length := int(binary.LittleEndian.Uint16(data[0:]))
+	valueLength := int(binary.LittleEndian.Uint16(data[2:]))
+	if length < 6 || length > len(data) {
+		return "", nil, nil, nil, false
+	}
+	if binary.LittleEndian.Uint16(data[4:]) == 1 {
+		valueLength *= 2
+	}
+	block := data[:length]
+
+	i := 6
+	var name []uint16
+	for i+1 < length {
+		c := binary.LittleEndian.Uint16(block[i:])
+		i += 2
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	i = min(align4(i), length)
+	end := min(i+valueLength, length)
+	value = block[i:end]
+	children = block[min(align4(end), length):]
+	next = data[min(align4(length), len(data)):]
+	return string(utf16.Decode(name)), value, children, next, true
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// utf16String decodes a little-endian UTF-16 string up to its NUL.
+func utf16String(data []byte) string {
+	chars := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+	return string(utf16.Decode(chars))
+}
@@ -0,0 +1,21 @@
+package fileanalysis
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileCapabilities reads the security.capability attribute. Files without
+// capabilities return no data.
+func fileCapabilities(path string) ([]byte, error) {
+	data := make([]byte, 64)
+	n, err := unix.Getxattr(path, "security.capability", data)
+	if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
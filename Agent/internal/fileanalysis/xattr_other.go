@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fileanalysis
+
+// fileCapabilities reports no capabilities; they only exist on Linux.
+func fileCapabilities(path string) ([]byte, error) {
+	return nil, nil
+}
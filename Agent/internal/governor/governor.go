@@ -0,0 +1,268 @@
+package governor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const logPrefix = "governor"
+
+// sampleInterval is how often the load and the agent's CPU use are read.
+const sampleInterval = time.Second
+
+// Governor keeps the scans from starving the host. It bounds how many files
+// are hashed and verified at once, throttles hashing to a byte rate, hashes
+// only the start of very large files and backs off while the host is busy.
+type Governor struct {
+	config  models.GovernorConfig
+	slots   chan struct{}
+	hashing *rateLimiter
+	self    *process.Process
+
+	sampledAt  time.Time
+	loadPerCPU float64
+	agentCPU   float64
+	sampleMu   sync.Mutex
+
+	metrics Metrics
+	stages  map[string]*StageDuration
+	mu      sync.Mutex
+}
+
+// Metrics describes the scan durations and how much the governor has
+// throttled the scans.
+type Metrics struct {
+	MaxWorkers      int             `json:"maxWorkers"`
+	ActiveWorkers   int             `json:"activeWorkers"`
+	FilesHashed     int64           `json:"filesHashed"`
+	PartialHashes   int64           `json:"partialHashes"`
+	BytesHashed     int64           `json:"bytesHashed"`
+	BytesAnalyzed   int64           `json:"bytesAnalyzed"`
+	RateLimitWaitMs int64           `json:"rateLimitWaitMs"`
+	Backoffs        int64           `json:"backoffs"`
+	BackoffMs       int64           `json:"backoffMs"`
+	BackingOff      bool            `json:"backingOff"`
+	LoadPerCPU      float64         `json:"loadPerCpu"`
+	AgentCPU        float64         `json:"agentCpuPercent"`
+	SampledAt       time.Time       `json:"sampledAt,omitempty"`
+	Stages          []StageDuration `json:"stages"`
+}
+
+// StageDuration sums up how long the runs of a scan stage took.
+type StageDuration struct {
+	Stage  string    `json:"stage"`
+	Runs   int64     `json:"runs"`
+	LastMs int64     `json:"lastMs"`
+	AvgMs  int64     `json:"avgMs"`
+	MaxMs  int64     `json:"maxMs"`
+	LastAt time.Time `json:"lastAt"`
+
+	totalMs int64
+}
+
+// New creates a governor, filling in the defaults for unset limits.
+func New(cfg *models.GovernorConfig) *Governor {
+	var config models.GovernorConfig
+	if cfg != nil {
+		config = *cfg
+	}
+	if config.MaxWorkers <= 0 {
+		config.MaxWorkers = models.DefaultGovernorWorkers
+	}
+	if config.PartialHashMB <= 0 {
+		config.PartialHashMB = models.DefaultPartialHashMB
+	}
+	if config.BackoffSeconds <= 0 {
+		config.BackoffSeconds = models.DefaultBackoffSeconds
+	}
+	if config.MaxBackoffSeconds < config.BackoffSeconds {
+		config.MaxBackoffSeconds = max(models.DefaultMaxBackoffSeconds, config.BackoffSeconds)
+	}
+
+	g := &Governor{
+		config: config,
+		slots:  make(chan struct{}, config.MaxWorkers),
+		stages: make(map[string]*StageDuration),
+	}
+	if config.HashMBPerSecond > 0 {
+		g.hashing = &rateLimiter{bytesPerSecond: config.HashMBPerSecond * 1024 * 1024}
+	}
+	if config.MaxAgentCPUPercent > 0 {
+		self, err := process.NewProcess(int32(os.Getpid()))
+		if err != nil {
+			logger.LogError(logPrefix, "Failed to watch the agent's CPU use", "", err)
+		}
+		g.self = self
+	}
+	g.metrics.MaxWorkers = config.MaxWorkers
+	return g
+}
+
+// Workers is how many files may be hashed and verified at once.
+func (g *Governor) Workers() int {
+	return g.config.MaxWorkers
+}
+
+// Acquire waits until the host is no longer busy and a worker slot is
+// free. The returned function gives the slot back.
+func (g *Governor) Acquire(ctx context.Context) (func(), error) {
+	if err := g.waitForIdle(ctx); err != nil {
+		return nil, err
+	}
+	select {
+	case g.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	g.mu.Lock()
+	g.metrics.ActiveWorkers++
+	g.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			g.metrics.ActiveWorkers--
+			g.mu.Unlock()
+			<-g.slots
+		})
+	}, nil
+}
+
+// waitForIdle backs off, doubling the delay up to the maximum, for as long
+// as the load or the agent's CPU use is over its limit.
+func (g *Governor) waitForIdle(ctx context.Context) error {
+	delay := time.Duration(g.config.BackoffSeconds) * time.Second
+	maxDelay := time.Duration(g.config.MaxBackoffSeconds) * time.Second
+
+	for {
+		reason := g.busy()
+		if reason == "" {
+			g.setBackingOff(false)
+			return nil
+		}
+		if !g.setBackingOff(true) {
+			logger.LogWarning(logPrefix, "Host is busy, backing off scans", reason)
+		}
+
+		start := time.Now()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+
+		g.mu.Lock()
+		g.metrics.Backoffs++
+		g.metrics.BackoffMs += time.Since(start).Milliseconds()
+		g.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// setBackingOff records whether the scans are backing off and returns the
+// previous state.
+func (g *Governor) setBackingOff(backingOff bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	previous := g.metrics.BackingOff
+	g.metrics.BackingOff = backingOff
+	return previous
+}
+
+// busy returns why the host is too busy to scan, or an empty string.
+func (g *Governor) busy() string {
+	if g.config.MaxLoadPerCPU <= 0 && g.self == nil {
+		return ""
+	}
+	loadPerCPU, agentCPU := g.sample()
+	if g.config.MaxLoadPerCPU > 0 && loadPerCPU > g.config.MaxLoadPerCPU {
+		return fmt.Sprintf("load average %.2f per CPU is over %.2f", loadPerCPU, g.config.MaxLoadPerCPU)
+	}
+	if g.self != nil && agentCPU > g.config.MaxAgentCPUPercent {
+		return fmt.Sprintf("agent CPU use %.0f%% is over %.0f%%", agentCPU, g.config.MaxAgentCPUPercent)
+	}
+	return ""
+}
+
+// sample reads the one-minute load average per CPU and the agent's CPU use
+// since the previous sample, at most once per sampleInterval.
+func (g *Governor) sample() (float64, float64) {
+	g.sampleMu.Lock()
+	defer g.sampleMu.Unlock()
+
+	if time.Since(g.sampledAt) < sampleInterval {
+		return g.loadPerCPU, g.agentCPU
+	}
+	g.sampledAt = time.Now()
+	if g.config.MaxLoadPerCPU > 0 {
+		if avg, err := load.Avg(); err == nil {
+			g.loadPerCPU = avg.Load1 / float64(runtime.NumCPU())
+		}
+	}
+	if g.self != nil {
+		if percent, err := g.self.Percent(0); err == nil {
+			g.agentCPU = percent
+		}
+	}
+
+	g.mu.Lock()
+	g.metrics.LoadPerCPU = g.loadPerCPU
+	g.metrics.AgentCPU = g.agentCPU
+	g.metrics.SampledAt = g.sampledAt
+	g.mu.Unlock()
+	return g.loadPerCPU, g.agentCPU
+}
+
+// ObserveScan records the duration of a run of a scan stage that began at
+// start. It is meant to be deferred.
+func (g *Governor) ObserveScan(stage string, start time.Time) {
+	took := time.Since(start)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	d, ok := g.stages[stage]
+	if !ok {
+		d = &StageDuration{Stage: stage}
+		g.stages[stage] = d
+	}
+	ms := took.Milliseconds()
+	d.Runs++
+	d.LastMs = ms
+	d.MaxMs = max(d.MaxMs, ms)
+	d.totalMs += ms
+	d.AvgMs = d.totalMs / d.Runs
+	d.LastAt = time.Now()
+}
+
+// Metrics returns the scan durations, ordered by stage, and the throttling
+// counters.
+func (g *Governor) Metrics() Metrics {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	metrics := g.metrics
+	metrics.Stages = make([]StageDuration, 0, len(g.stages))
+	for _, d := range g.stages {
+		metrics.Stages = append(metrics.Stages, *d)
+	}
+	sort.Slice(metrics.Stages, func(i, j int) bool { return metrics.Stages[i].Stage < metrics.Stages[j].Stage })
+	return metrics
+}
@@ -0,0 +1,141 @@
+package governor
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// hashChunkSize is how much is read, and charged to the rate limit, at once.
+const hashChunkSize = 256 * 1024
+
+// Hashes are the hashes of a file. Partial is set when the file was over
+// the size ceiling and only its first bytes were hashed.
+type Hashes struct {
+	MD5     string
+	SHA256  string
+	Partial bool
+}
+
+// HashFile calculates the MD5 and SHA-256 of a file within the hashing
+// rate. Files over the size ceiling get a partial hash.
+func (g *Governor) HashFile(ctx context.Context, path string) (Hashes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Hashes{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Hashes{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	var hashes Hashes
+	var r io.Reader = file
+	if ceiling := g.config.MaxHashSizeMB * 1024 * 1024; ceiling > 0 && info.Size() > ceiling {
+		r = io.LimitReader(file, g.config.PartialHashMB*1024*1024)
+		hashes.Partial = true
+	}
+
+	md5Hasher := md5.New()
+	sha256Hasher := sha256.New()
+	w := io.MultiWriter(md5Hasher, sha256Hasher)
+
+	buf := make([]byte, hashChunkSize)
+	var read int64
+	var waited time.Duration
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if g.hashing != nil {
+				wait, err := g.hashing.wait(ctx, n)
+				waited += wait
+				if err != nil {
+					return Hashes{}, err
+				}
+			}
+			w.Write(buf[:n])
+			read += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Hashes{}, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+
+	g.mu.Lock()
+	g.metrics.FilesHashed++
+	g.metrics.BytesHashed += read
+	g.metrics.RateLimitWaitMs += waited.Milliseconds()
+	if hashes.Partial {
+		g.metrics.PartialHashes++
+	}
+	g.mu.Unlock()
+
+	hashes.MD5 = hex.EncodeToString(md5Hasher.Sum(nil))
+	hashes.SHA256 = hex.EncodeToString(sha256Hasher.Sum(nil))
+	return hashes, nil
+}
+
+// Throttle returns a function that waits until n more bytes may be read
+// within the hashing rate, for reads other than hashing, such as the static
+// analysis of a file.
+func (g *Governor) Throttle(ctx context.Context) func(n int) error {
+	return func(n int) error {
+		var waited time.Duration
+		var err error
+		if g.hashing != nil {
+			waited, err = g.hashing.wait(ctx, n)
+		}
+
+		g.mu.Lock()
+		g.metrics.RateLimitWaitMs += waited.Milliseconds()
+		if err == nil {
+			g.metrics.BytesAnalyzed += int64(n)
+		}
+		g.mu.Unlock()
+		return err
+	}
+}
+
+// rateLimiter spreads reads over time so that all the workers together stay
+// within bytesPerSecond.
+type rateLimiter struct {
+	bytesPerSecond int64
+	next           time.Time
+	mu             sync.Mutex
+}
+
+// wait reserves n bytes of the budget and sleeps until they may be read. It
+// returns how long it slept.
+func (l *rateLimiter) wait(ctx context.Context, n int) (time.Duration, error) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.bytesPerSecond))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return wait, ctx.Err()
+	}
+}
@@ -0,0 +1,237 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/threatintel"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+// Reasons reported in MasqueradeMatch.Reason.
+const (
+	MasqueradeWrongPath        = "wrongPath"
+	MasqueradeUnexpectedParent = "unexpectedParent"
+	MasqueradeTyposquat        = "typosquat"
+	MasqueradeFakeKernelThread = "fakeKernelThread"
+)
+
+// minTyposquatLength keeps short names, where a single edit turns one real
+// tool into another, out of the typosquat check.
+const minTyposquatLength = 6
+
+// DefaultMasqueradeTable is used when no table file is configured.
+var DefaultMasqueradeTable = models.MasqueradeTable{
+	Binaries: []models.SystemBinary{
+		{Name: "svchost.exe", Paths: []string{`*\windows\system32\svchost.exe`, `*\windows\syswow64\svchost.exe`}, Parents: []string{"services.exe", "msmpeng.exe"}},
+		{Name: "lsass.exe", Paths: []string{`*\windows\system32\lsass.exe`}, Parents: []string{"wininit.exe"}},
+		{Name: "services.exe", Paths: []string{`*\windows\system32\services.exe`}, Parents: []string{"wininit.exe"}},
+		{Name: "explorer.exe", Paths: []string{`*\windows\explorer.exe`, `*\windows\syswow64\explorer.exe`}},
+	},
+	KernelThreads: []string{"kworker", "kthreadd", "ksoftirqd", "kswapd", "migration", "rcu_"},
+}
+
+// MasqueradeMatch is one reason a process looks like it imitates another.
+type MasqueradeMatch struct {
+	Reason   string `json:"reason"`
+	Imitates string `json:"imitates,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// MasqueradeChecker flags processes imitating system binaries.
+type MasqueradeChecker struct {
+	binaries      map[string]systemBinary
+	allow         []string
+	kernelThreads []string
+	maxDistance   int
+}
+
+type systemBinary struct {
+	binary  models.SystemBinary
+	paths   *threatintel.PathMatcher
+	parents []string
+}
+
+// LoadMasqueradeTable reads the table at path. An empty path loads the
+// default table.
+func LoadMasqueradeTable(path string, maxDistance int) (*MasqueradeChecker, error) {
+	if path == "" {
+		return NewMasqueradeChecker(DefaultMasqueradeTable, maxDistance), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to read masquerade table", path, err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var table models.MasqueradeTable
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		logger.LogError(logPrefix, "Failed to unmarshal masquerade table", path, err)
+		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
+	}
+
+	checker := NewMasqueradeChecker(table, maxDistance)
+	logger.LogInfo(logPrefix, fmt.Sprintf("Loaded %d system binaries", len(checker.binaries)), path, nil)
+	return checker, nil
+}
+
+// NewMasqueradeChecker compiles a table, skipping invalid entries. Names
+// within maxDistance edits of a system binary are reported as typosquats.
+func NewMasqueradeChecker(table models.MasqueradeTable, maxDistance int) *MasqueradeChecker {
+	if maxDistance <= 0 {
+		maxDistance = models.DefaultMaxEditDistance
+	}
+	checker := &MasqueradeChecker{binaries: make(map[string]systemBinary), maxDistance: maxDistance}
+
+	for _, binary := range table.Binaries {
+		name := strings.ToLower(binary.Name)
+		if name == "" {
+			logger.LogWarning(logPrefix, "Skipping system binary without a name", "", nil)
+			continue
+		}
+		compiled := systemBinary{binary: binary}
+		if len(binary.Paths) > 0 {
+			paths, err := threatintel.CompilePathPatterns(binary.Paths)
+			if err != nil {
+				logger.LogWarning(logPrefix, "Skipping invalid system binary", binary.Name, err)
+				continue
+			}
+			compiled.paths = paths
+		}
+		for _, parent := range binary.Parents {
+			compiled.parents = append(compiled.parents, strings.ToLower(parent))
+		}
+		checker.binaries[name] = compiled
+	}
+	for _, name := range table.Allow {
+		checker.allow = append(checker.allow, strings.ToLower(name))
+	}
+	for _, prefix := range table.KernelThreads {
+		checker.kernelThreads = append(checker.kernelThreads, strings.ToLower(prefix))
+	}
+	return checker
+}
+
+// Len returns the number of system binaries in the table.
+func (c *MasqueradeChecker) Len() int {
+	return len(c.binaries)
+}
+
+// Check returns every reason p looks like a masquerading process. parent
+// is nil when the parent is unknown.
+func (c *MasqueradeChecker) Check(p Process, parent *Process) []MasqueradeMatch {
+	var matches []MasqueradeMatch
+	name := strings.ToLower(processName(p))
+
+	if binary, ok := c.binaries[name]; ok {
+		if p.ExePath != "" && binary.paths != nil && !binary.paths.Match(p.ExePath) {
+			matches = append(matches, MasqueradeMatch{
+				Reason:   MasqueradeWrongPath,
+				Imitates: binary.binary.Name,
+				Detail:   fmt.Sprintf("runs from %s, expected %s", p.ExePath, strings.Join(binary.binary.Paths, " or ")),
+			})
+		}
+		if parent != nil && len(binary.parents) > 0 && !slices.Contains(binary.parents, strings.ToLower(processName(*parent))) {
+			matches = append(matches, MasqueradeMatch{
+				Reason:   MasqueradeUnexpectedParent,
+				Imitates: binary.binary.Name,
+				Detail:   fmt.Sprintf("started by %s, expected %s", processName(*parent), strings.Join(binary.binary.Parents, " or ")),
+			})
+		}
+	} else if target, distance := c.closest(name); target != "" {
+		matches = append(matches, MasqueradeMatch{
+			Reason:   MasqueradeTyposquat,
+			Imitates: target,
+			Detail:   fmt.Sprintf("name is %d edit(s) away from %s", distance, target),
+		})
+	}
+
+	// Kernel threads have no executable, so a process that looks like one
+	// but is backed by a file on disk is hiding in plain sight.
+	if p.ExePath != "" {
+		if thread, ok := c.kernelThreadName(p); ok {
+			matches = append(matches, MasqueradeMatch{
+				Reason:   MasqueradeFakeKernelThread,
+				Imitates: thread,
+				Detail:   fmt.Sprintf("looks like kernel thread %s but runs %s", thread, p.ExePath),
+			})
+		}
+	}
+	return matches
+}
+
+// closest returns the system binary name within the edit distance limit
+// that is nearest to name.
+func (c *MasqueradeChecker) closest(name string) (string, int) {
+	if len(name) < minTyposquatLength || slices.Contains(c.allow, name) {
+		return "", 0
+	}
+	best, bestDistance := "", c.maxDistance+1
+	for target, binary := range c.binaries {
+		if len(target) < minTyposquatLength || abs(len(target)-len(name)) > c.maxDistance {
+			continue
+		}
+		if distance := editDistance(name, target); distance > 0 && distance < bestDistance {
+			best, bestDistance = binary.binary.Name, distance
+		}
+	}
+	return best, bestDistance
+}
+
+// kernelThreadName reports the kernel thread a process imitates, either
+// through a bracketed command line as ps shows kernel threads or through a
+// kernel thread name.
+func (c *MasqueradeChecker) kernelThreadName(p Process) (string, bool) {
+	cmdline := strings.TrimSpace(p.Cmdline)
+	if strings.HasPrefix(cmdline, "[") && strings.HasSuffix(cmdline, "]") {
+		return cmdline, true
+	}
+	name := strings.ToLower(p.Name)
+	for _, prefix := range c.kernelThreads {
+		if strings.HasPrefix(name, prefix) {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// editDistance is the optimal string alignment distance: insertions,
+// deletions, substitutions and swaps of adjacent characters each count as
+// one edit, so "scvhost.exe" is one edit away from "svchost.exe".
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
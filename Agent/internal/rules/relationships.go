@@ -0,0 +1,264 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/threatintel"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+const logPrefix = "rules"
+
+// maxRuleDepth bounds how far up the process tree a rule may look.
+const maxRuleDepth = 8
+
+var severities = []string{models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical}
+
+// DefaultRelationshipRules are used when no rule file is configured.
+var DefaultRelationshipRules = []models.RelationshipRule{
+	{
+		ID:          "office-spawns-script-host",
+		Name:        "Office application started a shell or script host",
+		Description: "Macro documents commonly launch a shell or script host to fetch and run a payload.",
+		Severity:    models.SeverityHigh,
+		Tags:        []string{"T1566.001", "T1204.002", "T1059"},
+		Depth:       1,
+		Parent: models.ProcessMatcher{
+			Name: []string{"winword.exe", "excel.exe", "powerpnt.exe", "outlook.exe"},
+		},
+		Child: models.ProcessMatcher{
+			Name: []string{"powershell.exe", "cmd.exe", "wscript.exe", "cscript.exe", "mshta.exe"},
+		},
+	},
+}
+
+// Process is one process in the chain a rule is evaluated against.
+type Process struct {
+	PID     int32
+	Name    string
+	ExePath string
+	Cmdline string
+}
+
+// Signature is what is known about the signature of an executable. Signer
+// is only set for a verified signature. Checked is false when the signature
+// could not be read, and signature conditions then match nothing.
+type Signature struct {
+	Signer  string
+	Signed  bool
+	Checked bool
+}
+
+// SignerFunc returns the signature of an executable.
+type SignerFunc func(exePath string) Signature
+
+// RelationshipMatch is a rule that fired. Depth is how many levels above
+// the child the matching ancestor was found.
+type RelationshipMatch struct {
+	Rule  models.RelationshipRule
+	Depth int
+}
+
+// RelationshipEngine evaluates parent-child rules against process chains.
+type RelationshipEngine struct {
+	rules    []relationshipRule
+	maxDepth int
+}
+
+type relationshipRule struct {
+	rule   models.RelationshipRule
+	parent processMatcher
+	child  processMatcher
+}
+
+type processMatcher struct {
+	names   []string
+	paths   *threatintel.PathMatcher
+	cmdline *regexp.Regexp
+	signers *threatintel.PathMatcher
+	signed  *bool
+}
+
+type ruleFile struct {
+	Rules []models.RelationshipRule `yaml:"rules"`
+}
+
+// LoadRelationshipRules reads the rule file at path. An empty path loads
+// the default rules. Invalid rules are skipped with a warning.
+func LoadRelationshipRules(path string) (*RelationshipEngine, error) {
+	if path == "" {
+		return NewRelationshipEngine(DefaultRelationshipRules), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to read relationship rules", path, err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var file ruleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		logger.LogError(logPrefix, "Failed to unmarshal relationship rules", path, err)
+		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
+	}
+
+	engine := NewRelationshipEngine(file.Rules)
+	logger.LogInfo(logPrefix, fmt.Sprintf("Loaded %d relationship rules", len(engine.rules)), path, nil)
+	return engine, nil
+}
+
+// NewRelationshipEngine compiles rules, skipping the invalid ones.
+func NewRelationshipEngine(rules []models.RelationshipRule) *RelationshipEngine {
+	engine := &RelationshipEngine{}
+	for _, rule := range rules {
+		compiled, err := compileRelationshipRule(rule)
+		if err != nil {
+			logger.LogWarning(logPrefix, "Skipping invalid relationship rule", rule.ID, err)
+			continue
+		}
+		engine.rules = append(engine.rules, compiled)
+		engine.maxDepth = max(engine.maxDepth, compiled.rule.Depth)
+	}
+	return engine
+}
+
+func compileRelationshipRule(rule models.RelationshipRule) (relationshipRule, error) {
+	if rule.ID == "" {
+		return relationshipRule{}, fmt.Errorf("missing id")
+	}
+	if rule.Depth == 0 {
+		rule.Depth = 1
+	}
+	if rule.Depth < 0 || rule.Depth > maxRuleDepth {
+		return relationshipRule{}, fmt.Errorf("depth must be between 1 and %d", maxRuleDepth)
+	}
+	rule.Severity = strings.ToLower(rule.Severity)
+	if rule.Severity == "" {
+		rule.Severity = models.SeverityMedium
+	}
+	if !slices.Contains(severities, rule.Severity) {
+		return relationshipRule{}, fmt.Errorf("unknown severity: %s", rule.Severity)
+	}
+
+	parent, err := compileProcessMatcher(rule.Parent)
+	if err != nil {
+		return relationshipRule{}, fmt.Errorf("parent: %w", err)
+	}
+	child, err := compileProcessMatcher(rule.Child)
+	if err != nil {
+		return relationshipRule{}, fmt.Errorf("child: %w", err)
+	}
+	return relationshipRule{rule: rule, parent: parent, child: child}, nil
+}
+
+// compileProcessMatcher prepares a matcher. Names are compared
+// case-insensitively, paths and signers are globs and the command line is a
+// case-insensitive regular expression.
+func compileProcessMatcher(m models.ProcessMatcher) (processMatcher, error) {
+	if len(m.Name) == 0 && len(m.Path) == 0 && m.Cmdline == "" && len(m.Signer) == 0 && m.Signed == nil {
+		return processMatcher{}, fmt.Errorf("matcher is empty")
+	}
+
+	compiled := processMatcher{signed: m.Signed}
+	for _, name := range m.Name {
+		compiled.names = append(compiled.names, strings.ToLower(name))
+	}
+
+	var err error
+	if len(m.Path) > 0 {
+		if compiled.paths, err = threatintel.CompilePathPatterns(m.Path); err != nil {
+			return processMatcher{}, err
+		}
+	}
+	if len(m.Signer) > 0 {
+		// Signer names never contain separators, so the glob is applied to
+		// the whole name.
+		if compiled.signers, err = threatintel.CompilePathPatterns(m.Signer); err != nil {
+			return processMatcher{}, err
+		}
+	}
+	if m.Cmdline != "" {
+		if compiled.cmdline, err = regexp.Compile("(?i)" + m.Cmdline); err != nil {
+			return processMatcher{}, fmt.Errorf("invalid cmdline regex: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+func (m processMatcher) matches(p Process, signerOf SignerFunc) bool {
+	if len(m.names) > 0 && !slices.Contains(m.names, strings.ToLower(processName(p))) {
+		return false
+	}
+	if m.paths != nil && !m.paths.Match(p.ExePath) {
+		return false
+	}
+	if m.cmdline != nil && !m.cmdline.MatchString(p.Cmdline) {
+		return false
+	}
+	// The signer is looked up last as it is the most expensive check.
+	if m.signers != nil || m.signed != nil {
+		if p.ExePath == "" || signerOf == nil {
+			return false
+		}
+		sig := signerOf(p.ExePath)
+		if !sig.Checked {
+			return false
+		}
+		if m.signed != nil && *m.signed != sig.Signed {
+			return false
+		}
+		if m.signers != nil && !m.signers.Match(sig.Signer) {
+			return false
+		}
+	}
+	return true
+}
+
+// processName falls back to the executable name when the process name is
+// unknown or truncated.
+func processName(p Process) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return filepath.Base(p.ExePath)
+}
+
+// MaxDepth is how many ancestors Match may look at.
+func (e *RelationshipEngine) MaxDepth() int {
+	return e.maxDepth
+}
+
+// Len returns the number of loaded rules.
+func (e *RelationshipEngine) Len() int {
+	return len(e.rules)
+}
+
+// Match evaluates every rule against a process chain. chain[0] is the child,
+// chain[1] its parent, chain[2] its grandparent and so on. Each rule fires at
+// most once, on the closest matching ancestor.
+func (e *RelationshipEngine) Match(chain []Process, signerOf SignerFunc) []RelationshipMatch {
+	if len(chain) < 2 {
+		return nil
+	}
+
+	var matches []RelationshipMatch
+	for _, r := range e.rules {
+		if !r.child.matches(chain[0], signerOf) {
+			continue
+		}
+		for depth := 1; depth <= r.rule.Depth && depth < len(chain); depth++ {
+			if r.parent.matches(chain[depth], signerOf) {
+				matches = append(matches, RelationshipMatch{Rule: r.rule, Depth: depth})
+				break
+			}
+		}
+	}
+	return matches
+}
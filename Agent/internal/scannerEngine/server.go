@@ -2,14 +2,53 @@ package scannerEngine
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/bhaiFi/security-monitor/internal/agentScanner"
 	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/internal/scanstore"
+	"github.com/bhaiFi/security-monitor/pkg/models"
 	"github.com/bhaiFi/security-monitor/pkg/rpcEngine"
 )
 
 const logPrefix = "ScannerEngine"
 
+// scheduleRequest is the payload of a setSchedule message.
+type scheduleRequest struct {
+	Stage string `json:"stage"`
+	models.StageSchedule
+}
+
+// subscribeRequest is the payload of a subscribe message.
+type subscribeRequest struct {
+	Types []string `json:"types"`
+}
+
+// changesRequest is the payload of a changesSince message.
+type changesRequest struct {
+	Cursor uint64 `json:"cursor"`
+}
+
+// ancestryRequest is the payload of a processAncestry message.
+type ancestryRequest struct {
+	PID int32 `json:"pid"`
+}
+
+// fileDetailsRequest is the payload of a fileDetails message.
+type fileDetailsRequest struct {
+	Path string `json:"path"`
+}
+
+// historyRequest is the payload of a queryHistory message.
+type historyRequest struct {
+	scanstore.Query
+}
+
+// stateRequest is the payload of a stateAt message.
+type stateRequest struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
 type RPCServer struct {
 	rpcEngine.UnimplementedServicesServer
 	scanner *agentScanner.Scanner
@@ -23,6 +62,8 @@ func NewRPCServer(scanner *agentScanner.Scanner) *RPCServer {
 }
 
 func (s *RPCServer) Messaging(stream rpcEngine.Services_MessagingServer) error {
+	sender := &streamSender{stream: stream}
+
 	for {
 		// Receive message from client
 		msg, err := stream.Recv()
@@ -35,6 +76,7 @@ func (s *RPCServer) Messaging(stream rpcEngine.Services_MessagingServer) error {
 		// Process based on message type
 		var response []byte
 		var responseType string
+		var followUp func()
 
 		switch msg.MessageType {
 		case "checkUnsigned":
@@ -70,6 +112,310 @@ func (s *RPCServer) Messaging(stream rpcEngine.Services_MessagingServer) error {
 				responseType = "relationshipResults"
 			}
 
+		case "checkMasquerade":
+			masquerades := s.scanner.GetMasquerades()
+			response, err = json.Marshal(masquerades)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal masquerading processes", "", err)
+				response = []byte("error marshaling masquerading processes")
+				responseType = "error"
+			} else {
+				responseType = "masqueradeResults"
+			}
+
+		case "checkImages":
+			imageFindings := s.scanner.GetImageFindings()
+			response, err = json.Marshal(imageFindings)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal image findings", "", err)
+				response = []byte("error marshaling image findings")
+				responseType = "error"
+			} else {
+				responseType = "imageResults"
+			}
+
+		case "checkAnomalies":
+			anomalies := s.scanner.GetAnomalies()
+			response, err = json.Marshal(anomalies)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal anomalies", "", err)
+				response = []byte("error marshaling anomalies")
+				responseType = "error"
+			} else {
+				responseType = "anomalyResults"
+			}
+
+		case "exportBaseline":
+			if response, err = s.scanner.ExportBaseline(); err != nil {
+				logger.LogError(logPrefix, "Failed to export learned baseline", "", err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else {
+				responseType = "baselineExport"
+			}
+
+		case "resetBaseline":
+			if err := s.scanner.ResetBaseline(); err != nil {
+				logger.LogError(logPrefix, "Failed to reset learned baseline", "", err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else {
+				response = []byte("baseline reset, training again")
+				responseType = "baselineReset"
+			}
+
+		case "checkPathIndicators":
+			pathMatches := s.scanner.GetPathIndicatorMatches()
+			response, err = json.Marshal(pathMatches)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal path indicator matches", "", err)
+				response = []byte("error marshaling path indicator matches")
+				responseType = "error"
+			} else {
+				responseType = "pathIndicatorResults"
+			}
+
+		case "checkFiles":
+			fileFindings := s.scanner.GetFileFindings()
+			response, err = json.Marshal(fileFindings)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal file findings", "", err)
+				response = []byte("error marshaling file findings")
+				responseType = "error"
+			} else {
+				responseType = "fileResults"
+			}
+
+		case "checkModules":
+			moduleFindings := s.scanner.GetModuleFindings()
+			response, err = json.Marshal(moduleFindings)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal module findings", "", err)
+				response = []byte("error marshaling module findings")
+				responseType = "error"
+			} else {
+				responseType = "moduleResults"
+			}
+
+		case "checkPersistence":
+			persistence := s.scanner.GetPersistence()
+			response, err = json.Marshal(persistence)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal persistence entries", "", err)
+				response = []byte("error marshaling persistence entries")
+				responseType = "error"
+			} else {
+				responseType = "persistenceResults"
+			}
+
+		case "resetPersistenceBaseline":
+			if count, err := s.scanner.ResetPersistenceBaseline(); err != nil {
+				logger.LogError(logPrefix, "Failed to reset persistence baseline", "", err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else if response, err = json.Marshal(map[string]int{"entries": count}); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal persistence baseline", "", err)
+				response = []byte("error marshaling persistence baseline")
+				responseType = "error"
+			} else {
+				responseType = "persistenceBaselineReset"
+			}
+
+		case "checkRetroHunt":
+			retroHits := s.scanner.GetRetroHuntHits()
+			response, err = json.Marshal(retroHits)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal retro-hunt hits", "", err)
+				response = []byte("error marshaling retro-hunt hits")
+				responseType = "error"
+			} else {
+				responseType = "retroHuntResults"
+			}
+
+		case "checkNetwork":
+			connections := s.scanner.GetConnections()
+			response, err = json.Marshal(connections)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal network connections", "", err)
+				response = []byte("error marshaling network connections")
+				responseType = "error"
+			} else {
+				responseType = "networkResults"
+			}
+
+		case "riskRanking":
+			ranking := s.scanner.RiskRanking()
+			response, err = json.Marshal(ranking)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal risk ranking", "", err)
+				response = []byte("error marshaling risk ranking")
+				responseType = "error"
+			} else {
+				responseType = "riskResults"
+			}
+
+		case "scanMetrics":
+			metrics := s.scanner.ScanMetrics()
+			response, err = json.Marshal(metrics)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal scan metrics", "", err)
+				response = []byte("error marshaling scan metrics")
+				responseType = "error"
+			} else {
+				responseType = "scanMetricsResults"
+			}
+
+		case "queryHistory":
+			var req historyRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil {
+				logger.LogError(logPrefix, "Invalid history query", "", err)
+				response = []byte("invalid history query")
+				responseType = "error"
+			} else if result, err := s.scanner.QueryHistory(req.Query); err != nil {
+				logger.LogError(logPrefix, "Failed to query history", "", err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else if response, err = json.Marshal(result); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal history", "", err)
+				response = []byte("error marshaling history")
+				responseType = "error"
+			} else {
+				responseType = "historyResults"
+			}
+
+		case "stateAt":
+			var req stateRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil || req.Timestamp.IsZero() {
+				logger.LogError(logPrefix, "Invalid state request", "", err)
+				response = []byte("invalid state request")
+				responseType = "error"
+			} else if state, err := s.scanner.StateAt(req.Timestamp); err != nil {
+				logger.LogError(logPrefix, "Failed to reconstruct host state", req.Timestamp, err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else if response, err = json.Marshal(state); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal host state", "", err)
+				response = []byte("error marshaling host state")
+				responseType = "error"
+			} else {
+				responseType = "stateResults"
+			}
+
+		case "fileDetails":
+			var req fileDetailsRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil || req.Path == "" {
+				logger.LogError(logPrefix, "Invalid file details request", "", err)
+				response = []byte("invalid file details request")
+				responseType = "error"
+			} else if details, err := s.scanner.FileDetails(req.Path); err != nil {
+				logger.LogError(logPrefix, "Failed to get file details", req.Path, err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else if response, err = json.Marshal(details); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal file details", req.Path, err)
+				response = []byte("error marshaling file details")
+				responseType = "error"
+			} else {
+				responseType = "fileDetailsResults"
+			}
+
+		case "getSchedule":
+			response, responseType = s.scheduleResponse()
+
+		case "setSchedule":
+			var req scheduleRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil {
+				logger.LogError(logPrefix, "Failed to unmarshal schedule request", "", err)
+				response = []byte("invalid schedule request")
+				responseType = "error"
+			} else if err := s.scanner.UpdateSchedule(req.Stage, req.StageSchedule); err != nil {
+				logger.LogError(logPrefix, "Failed to update schedule", req.Stage, err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else {
+				response, responseType = s.scheduleResponse()
+			}
+
+		case "processEvents":
+			processEvents := s.scanner.GetProcessEvents()
+			response, err = json.Marshal(processEvents)
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal process events", "", err)
+				response = []byte("error marshaling process events")
+				responseType = "error"
+			} else {
+				responseType = "processEventResults"
+			}
+
+		case "processTree":
+			tree, err := s.scanner.ProcessTree(stream.Context())
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to build process tree", "", err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else if response, err = json.Marshal(tree); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal process tree", "", err)
+				response = []byte("error marshaling process tree")
+				responseType = "error"
+			} else {
+				responseType = "processTreeResults"
+			}
+
+		case "processAncestry":
+			var req ancestryRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil || req.PID <= 0 {
+				logger.LogError(logPrefix, "Invalid process ancestry request", "", err)
+				response = []byte("invalid process ancestry request")
+				responseType = "error"
+			} else if ancestry, err := s.scanner.ProcessAncestry(req.PID); err != nil {
+				logger.LogError(logPrefix, "Failed to get process ancestry", "", err)
+				response = []byte(err.Error())
+				responseType = "error"
+			} else if response, err = json.Marshal(ancestry); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal process ancestry", "", err)
+				response = []byte("error marshaling process ancestry")
+				responseType = "error"
+			} else {
+				responseType = "processAncestryResults"
+			}
+
+		case "changesSince":
+			var req changesRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil {
+				logger.LogError(logPrefix, "Invalid changesSince request", "", err)
+				response = []byte("invalid changesSince request")
+				responseType = "error"
+			} else if response, err = json.Marshal(s.scanner.ChangesSince(req.Cursor)); err != nil {
+				logger.LogError(logPrefix, "Failed to marshal changes", "", err)
+				response = []byte("error marshaling changes")
+				responseType = "error"
+			} else {
+				responseType = "changeResults"
+			}
+
+		case "scanNow":
+			run := s.scanner.ScanNow()
+			response, err = json.Marshal(run.Summary())
+			if err != nil {
+				logger.LogError(logPrefix, "Failed to marshal scan start", run.ID(), err)
+				response = []byte("error marshaling scan start")
+				responseType = "error"
+			} else {
+				responseType = "scanStarted"
+				followUp = func() { s.streamScanProgress(stream.Context(), sender, run) }
+			}
+
+		case "subscribe":
+			// The payload may list the event types wanted; anything else subscribes to all
+			var req subscribeRequest
+			if err := json.Unmarshal(msg.Message, &req); err != nil {
+				req.Types = nil
+			}
+			events, cancel := s.scanner.Subscribe(req.Types)
+			response, _ = json.Marshal(req)
+			responseType = "subscribed"
+			followUp = func() { s.streamEvents(stream.Context(), sender, events, cancel) }
+
 		default:
 			logger.LogError(logPrefix, "Unknown message type received", msg.MessageType, nil)
 			response = []byte("unknown request type")
@@ -77,14 +423,25 @@ func (s *RPCServer) Messaging(stream rpcEngine.Services_MessagingServer) error {
 		}
 
 		// Send response back to client
-		if err := stream.Send(&rpcEngine.Message{
-			Message:     response,
-			MessageType: responseType,
-		}); err != nil {
+		if err := sender.send(response, responseType); err != nil {
 			logger.LogError(logPrefix, "Failed to send response", "", err)
 			return err
 		}
 
 		logger.LogInfo(logPrefix, "Response sent successfully", responseType, nil)
+
+		// Streaming requests keep pushing messages while new requests are served
+		if followUp != nil {
+			go followUp()
+		}
+	}
+}
+
+func (s *RPCServer) scheduleResponse() ([]byte, string) {
+	response, err := json.Marshal(s.scanner.GetSchedule())
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to marshal schedule", "", err)
+		return []byte("error marshaling schedule"), "error"
 	}
+	return response, "scheduleResults"
 }
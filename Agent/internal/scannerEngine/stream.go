@@ -0,0 +1,81 @@
+package scannerEngine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/bhaiFi/security-monitor/internal/agentScanner"
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/rpcEngine"
+)
+
+// streamSender serializes sends on a Messaging stream, which gRPC does not
+// allow from several goroutines at once.
+type streamSender struct {
+	stream rpcEngine.Services_MessagingServer
+	mu     sync.Mutex
+}
+
+func (s *streamSender) send(message []byte, messageType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stream.Send(&rpcEngine.Message{
+		Message:     message,
+		MessageType: messageType,
+	})
+}
+
+func (s *streamSender) sendJSON(v interface{}, messageType string) error {
+	message, err := json.Marshal(v)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to marshal streamed message", messageType, err)
+		return err
+	}
+	return s.send(message, messageType)
+}
+
+// streamScanProgress pushes scanProgress messages until the scan ends and
+// then a final scanSummary.
+func (s *RPCServer) streamScanProgress(ctx context.Context, sender *streamSender, run *agentScanner.ScanRun) {
+	updates := run.Subscribe()
+	for {
+		select {
+		case progress, ok := <-updates:
+			if !ok {
+				if err := sender.sendJSON(run.Summary(), "scanSummary"); err != nil {
+					logger.LogError(logPrefix, "Failed to send scan summary", run.ID(), err)
+				}
+				return
+			}
+			if err := sender.sendJSON(progress, "scanProgress"); err != nil {
+				logger.LogError(logPrefix, "Failed to send scan progress", run.ID(), err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamEvents pushes subscribed events, each as a message of its event type,
+// until the client goes away.
+func (s *RPCServer) streamEvents(ctx context.Context, sender *streamSender, events <-chan agentScanner.Event, cancel func()) {
+	defer cancel()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := sender.sendJSON(event, event.Type); err != nil {
+				logger.LogError(logPrefix, "Failed to send event", event.Type, err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
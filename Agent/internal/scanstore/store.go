@@ -0,0 +1,520 @@
+package scanstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+const logPrefix = "scanstore"
+
+// Record kinds.
+const (
+	KindFinding  = "finding"
+	KindSnapshot = "snapshot"
+	KindEvent    = "event"
+)
+
+const (
+	// flushInterval is how long records wait to be written in one batch.
+	flushInterval = time.Second
+	// maxBatch is how many records are written in one transaction.
+	maxBatch = 1000
+	// queueSize is how many records may wait to be written before further
+	// records are dropped.
+	queueSize = 10000
+	// pruneInterval is how often the retention limits are enforced.
+	pruneInterval = time.Hour
+)
+
+var (
+	recordsBucket = []byte("records")
+	// The index buckets map a PID, executable path or hash followed by a
+	// record key to nothing, so filtered queries only read matching records.
+	pidIndex     = []byte("index:pid")
+	pathIndex    = []byte("index:path")
+	hashIndex    = []byte("index:hash")
+	indexBuckets = [][]byte{pidIndex, pathIndex, hashIndex}
+)
+
+// Record is a finding, snapshot entry or event kept in the store. PID,
+// ExePath and Hashes are copied out of Data so queries can filter on them.
+type Record struct {
+	Time    time.Time       `json:"time"`
+	Kind    string          `json:"kind"`
+	Type    string          `json:"type"`
+	PID     int32           `json:"pid,omitempty"`
+	ExePath string          `json:"exePath,omitempty"`
+	Hashes  []string        `json:"hashes,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Store keeps records in a bbolt database, ordered by time. Records are
+// queued and written in batches so scans never wait on the disk.
+type Store struct {
+	db     *bolt.DB
+	config models.HistoryStore
+	queue  chan Record
+	done   chan struct{}
+	closed bool
+	mu     sync.RWMutex
+}
+
+// Open opens or creates the database at cfg.Path and starts the writer.
+func Open(cfg *models.HistoryStore) (*Store, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("history store path is not configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history store directory: %w", err)
+	}
+	db, err := bolt.Open(cfg.Path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		records, err := tx.CreateBucketIfNotExists(recordsBucket)
+		if err != nil {
+			return err
+		}
+		// Stores written before the indexes existed are indexed once.
+		reindex := false
+		for _, name := range indexBuckets {
+			if tx.Bucket(name) == nil {
+				if _, err := tx.CreateBucket(name); err != nil {
+					return err
+				}
+				reindex = true
+			}
+		}
+		if !reindex {
+			return nil
+		}
+		return records.ForEach(func(k, v []byte) error {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return nil
+			}
+			return updateIndexes(tx, &record, k, true)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history buckets: %w", err)
+	}
+
+	s := &Store{
+		db:     db,
+		config: *cfg,
+		queue:  make(chan Record, queueSize),
+		done:   make(chan struct{}),
+	}
+	go s.write()
+	return s, nil
+}
+
+// Start enforces the retention limits until ctx is done, then closes the
+// store.
+func (s *Store) Start(ctx context.Context) {
+	go func() {
+		s.prune()
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.prune()
+			case <-ctx.Done():
+				s.Close()
+				return
+			}
+		}
+	}()
+}
+
+// Close writes the queued records and closes the database.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	return s.db.Close()
+}
+
+// Add queues records to be written. Records are dropped if the writer has
+// fallen too far behind.
+func (s *Store) Add(records ...Record) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+	for _, record := range records {
+		select {
+		case s.queue <- record:
+		default:
+			logger.LogWarning(logPrefix, "Write queue is full, record dropped", record.Type)
+		}
+	}
+}
+
+// write batches queued records into transactions until the queue is closed.
+func (s *Store) write() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []Record
+	for {
+		select {
+		case record, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) < maxBatch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (s *Store) flush(batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordsBucket)
+		for _, record := range batch {
+			value, err := json.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("failed to marshal record: %w", err)
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := recordKey(record.Time, seq)
+			if err := b.Put(key, value); err != nil {
+				return err
+			}
+			if err := updateIndexes(tx, &record, key, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to write records", len(batch), err)
+	}
+}
+
+// recordKey orders records by time; the sequence keeps records with the
+// same timestamp apart.
+func recordKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(max(t.UnixNano(), 0)))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+func timeKey(t time.Time) []byte {
+	return recordKey(t, 0)
+}
+
+// indexEntry is the bucket and key prefix under which a record is indexed
+// by one of its PID, executable path or hashes.
+type indexEntry struct {
+	bucket []byte
+	prefix []byte
+}
+
+func pidEntry(pid int32) indexEntry {
+	prefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(prefix, uint32(pid))
+	return indexEntry{bucket: pidIndex, prefix: prefix}
+}
+
+// textEntry indexes paths and hashes case-insensitively. The NUL ends the
+// value so one is never the prefix of another.
+func textEntry(bucket []byte, value string) indexEntry {
+	return indexEntry{bucket: bucket, prefix: append([]byte(strings.ToLower(value)), 0)}
+}
+
+func (r *Record) indexEntries() []indexEntry {
+	var entries []indexEntry
+	if r.PID != 0 {
+		entries = append(entries, pidEntry(r.PID))
+	}
+	if r.ExePath != "" {
+		entries = append(entries, textEntry(pathIndex, r.ExePath))
+	}
+	for _, hash := range r.Hashes {
+		if hash != "" {
+			entries = append(entries, textEntry(hashIndex, hash))
+		}
+	}
+	return entries
+}
+
+// updateIndexes adds or removes the index entries of the record at key.
+func updateIndexes(tx *bolt.Tx, r *Record, key []byte, add bool) error {
+	for _, entry := range r.indexEntries() {
+		b := tx.Bucket(entry.bucket)
+		indexKey := slices.Concat(entry.prefix, key)
+		var err error
+		if add {
+			err = b.Put(indexKey, []byte{})
+		} else {
+			err = b.Delete(indexKey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query selects records by time range and content. Zero fields match
+// everything; To is exclusive. Types matches the record type, such as a
+// finding type or an event type.
+type Query struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Kind    string    `json:"kind,omitempty"`
+	Types   []string  `json:"types,omitempty"`
+	PID     int32     `json:"pid,omitempty"`
+	ExePath string    `json:"exePath,omitempty"`
+	Hash    string    `json:"hash,omitempty"`
+	Limit   int       `json:"limit,omitempty"`
+}
+
+// QueryResult holds the matching records, oldest first. Truncated is set
+// when more records matched than the limit allowed.
+type QueryResult struct {
+	Records   []Record `json:"records"`
+	Truncated bool     `json:"truncated"`
+}
+
+// index picks the most selective index for the query, if it filters on a
+// hash, executable path or PID.
+func (q Query) index() (indexEntry, bool) {
+	switch {
+	case q.Hash != "":
+		return textEntry(hashIndex, q.Hash), true
+	case q.ExePath != "":
+		return textEntry(pathIndex, q.ExePath), true
+	case q.PID != 0:
+		return pidEntry(q.PID), true
+	}
+	return indexEntry{}, false
+}
+
+func (q Query) matches(r *Record) bool {
+	if q.Kind != "" && r.Kind != q.Kind {
+		return false
+	}
+	if len(q.Types) > 0 && !slices.Contains(q.Types, r.Type) {
+		return false
+	}
+	if q.PID != 0 && r.PID != q.PID {
+		return false
+	}
+	if q.ExePath != "" && !strings.EqualFold(r.ExePath, q.ExePath) {
+		return false
+	}
+	if q.Hash != "" && !slices.ContainsFunc(r.Hashes, func(h string) bool { return strings.EqualFold(h, q.Hash) }) {
+		return false
+	}
+	return true
+}
+
+// Query returns the records matching q, oldest first. Queries on a hash,
+// executable path or PID read the matching records through their index;
+// others walk every record in the time range.
+func (s *Store) Query(q Query) (QueryResult, error) {
+	limit := q.Limit
+	if limit <= 0 || limit > models.MaxHistoryQueryLimit {
+		limit = models.MaxHistoryQueryLimit
+	}
+
+	result := QueryResult{Records: []Record{}}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		var end []byte
+		if !q.To.IsZero() {
+			end = timeKey(q.To)
+		}
+
+		// collect adds the record at k if it matches and reports whether
+		// the walk should go on.
+		collect := func(k, v []byte) bool {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				return false
+			}
+			var record Record
+			if v == nil || json.Unmarshal(v, &record) != nil || !q.matches(&record) {
+				return true
+			}
+			if len(result.Records) == limit {
+				result.Truncated = true
+				return false
+			}
+			result.Records = append(result.Records, record)
+			return true
+		}
+
+		if index, ok := q.index(); ok {
+			c := tx.Bucket(index.bucket).Cursor()
+			for k, _ := c.Seek(slices.Concat(index.prefix, timeKey(q.From))); k != nil && bytes.HasPrefix(k, index.prefix); k, _ = c.Next() {
+				key := k[len(index.prefix):]
+				if !collect(key, records.Get(key)) {
+					break
+				}
+			}
+			return nil
+		}
+
+		c := records.Cursor()
+		for k, v := c.Seek(timeKey(q.From)); k != nil; k, v = c.Next() {
+			if !collect(k, v) {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return QueryResult{}, fmt.Errorf("failed to query history: %w", err)
+	}
+	return result, nil
+}
+
+// SnapshotBefore returns the latest snapshot of the given type taken at or
+// before t, or nil if there is none.
+func (s *Store) SnapshotBefore(snapshotType string, t time.Time) ([]Record, error) {
+	return s.snapshot(snapshotType, t, true)
+}
+
+// SnapshotAfter returns the first snapshot of the given type taken after t,
+// or nil if there is none.
+func (s *Store) SnapshotAfter(snapshotType string, t time.Time) ([]Record, error) {
+	return s.snapshot(snapshotType, t, false)
+}
+
+// snapshot walks from t backwards or forwards to the nearest snapshot of
+// the given type. The records of a snapshot all share its time.
+func (s *Store) snapshot(snapshotType string, t time.Time, before bool) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(recordsBucket).Cursor()
+		// Keys of records at t sort before the key of the next nanosecond.
+		start := timeKey(t.Add(time.Nanosecond))
+		step := c.Next
+		k, v := c.Seek(start)
+		if before {
+			step = c.Prev
+			if k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		var taken time.Time
+		for ; k != nil; k, v = step() {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				continue
+			}
+			if !taken.IsZero() && !record.Time.Equal(taken) {
+				break
+			}
+			if record.Kind != KindSnapshot || record.Type != snapshotType {
+				continue
+			}
+			taken = record.Time
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return records, nil
+}
+
+// prune deletes the records older than the retention period and then the
+// oldest records beyond the record limit.
+func (s *Store) prune() {
+	var deleted int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordsBucket)
+
+		// Keys are collected first, as deleting under a cursor can skip
+		// the next key.
+		var expired [][]byte
+		c := b.Cursor()
+		if s.config.RetentionDays > 0 {
+			cutoff := timeKey(time.Now().AddDate(0, 0, -s.config.RetentionDays))
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+				expired = append(expired, slices.Clone(k))
+			}
+		}
+		if s.config.MaxRecords > 0 {
+			excess := b.Stats().KeyN - len(expired) - s.config.MaxRecords
+			k, _ := c.First()
+			for range len(expired) {
+				k, _ = c.Next()
+			}
+			for ; k != nil && excess > 0; k, _ = c.Next() {
+				expired = append(expired, slices.Clone(k))
+				excess--
+			}
+		}
+
+		for _, k := range expired {
+			var record Record
+			if err := json.Unmarshal(b.Get(k), &record); err == nil {
+				if err := updateIndexes(tx, &record, k, false); err != nil {
+					return err
+				}
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to prune history", s.config.Path, err)
+		return
+	}
+	if deleted > 0 {
+		logger.LogInfo(logPrefix, fmt.Sprintf("Pruned %d records past the retention limits", deleted), s.config.Path, nil)
+	}
+}
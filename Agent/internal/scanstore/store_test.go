@@ -0,0 +1,138 @@
+package scanstore
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+func openTestStore(t *testing.T, cfg models.HistoryStore) *Store {
+	t.Helper()
+	logger.Logging = zap.NewNop()
+	if cfg.Path == "" {
+		cfg.Path = filepath.Join(t.TempDir(), "history.db")
+	}
+	s, err := Open(&cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// addRecords writes records straight away rather than waiting for the
+// writer's next flush.
+func addRecords(s *Store, records ...Record) {
+	s.flush(records)
+}
+
+func testRecord(t time.Time, pid int32, path, hash string) Record {
+	r := Record{Time: t, Kind: KindEvent, Type: "processStart", PID: pid, ExePath: path, Data: json.RawMessage(`{}`)}
+	if hash != "" {
+		r.Hashes = []string{hash}
+	}
+	return r
+}
+
+func TestQueryIndexes(t *testing.T) {
+	s := openTestStore(t, models.HistoryStore{})
+	base := time.Now().Add(-time.Hour)
+	addRecords(s,
+		testRecord(base, 10, `C:\Tools\a.exe`, "AAAA"),
+		testRecord(base.Add(time.Minute), 11, `C:\Tools\b.exe`, "bbbb"),
+		testRecord(base.Add(2*time.Minute), 10, `C:\Tools\a.exe`, "aaaa"),
+		testRecord(base.Add(3*time.Minute), 100, `C:\Tools\a.exe.bak`, ""),
+	)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"pid", Query{PID: 10}, 2},
+		{"path ignores case", Query{ExePath: `c:\tools\A.EXE`}, 2},
+		{"path is exact", Query{ExePath: `C:\Tools\a`}, 0},
+		{"hash ignores case", Query{Hash: "aaaa"}, 2},
+		{"hash and pid", Query{Hash: "aaaa", PID: 11}, 0},
+		{"time range", Query{PID: 10, From: base.Add(time.Second), To: base.Add(time.Hour)}, 1},
+		{"to is exclusive", Query{PID: 10, To: base.Add(2 * time.Minute)}, 1},
+		{"unfiltered", Query{}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if len(result.Records) != tt.want {
+				t.Errorf("got %d records, want %d", len(result.Records), tt.want)
+			}
+		})
+	}
+
+	result, err := s.Query(Query{ExePath: `C:\Tools\a.exe`, Limit: 1})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(result.Records) != 1 || !result.Truncated || !result.Records[0].Time.Equal(base) {
+		t.Errorf("limited query = %+v, want the oldest record, truncated", result)
+	}
+}
+
+func TestPruneRemovesIndexEntries(t *testing.T) {
+	s := openTestStore(t, models.HistoryStore{MaxRecords: 1})
+	base := time.Now().Add(-time.Hour)
+	addRecords(s,
+		testRecord(base, 10, `/usr/bin/a`, "aaaa"),
+		testRecord(base.Add(time.Minute), 11, `/usr/bin/b`, "bbbb"),
+	)
+	s.prune()
+
+	if result, _ := s.Query(Query{PID: 10}); len(result.Records) != 0 {
+		t.Errorf("pruned record is still found: %+v", result.Records)
+	}
+	s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range indexBuckets {
+			// The remaining record has one entry per index.
+			if n := tx.Bucket(name).Stats().KeyN; n != 1 {
+				t.Errorf("%s has %d entries, want 1", name, n)
+			}
+		}
+		return nil
+	})
+}
+
+func TestOpenIndexesExistingRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	s := openTestStore(t, models.HistoryStore{Path: path})
+	addRecords(s, testRecord(time.Now(), 10, `/usr/bin/a`, "aaaa"))
+
+	// Drop the indexes as a store written before they existed would have.
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range indexBuckets {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	reopened := openTestStore(t, models.HistoryStore{Path: path})
+	result, err := reopened.Query(Query{Hash: "AAAA"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(result.Records) != 1 {
+		t.Errorf("got %d records from the rebuilt index, want 1", len(result.Records))
+	}
+}
@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+const logPrefix = "scheduler"
+
+// StageStatus describes a registered stage and its upcoming run.
+type StageStatus struct {
+	Stage    string               `json:"stage"`
+	Schedule models.StageSchedule `json:"schedule"`
+	NextRun  time.Time            `json:"nextRun"`
+	LastRun  time.Time            `json:"lastRun"`
+	Running  bool                 `json:"running"`
+}
+
+type job struct {
+	name     string
+	schedule models.StageSchedule
+	cron     *cronExpr
+	run      func(ctx context.Context)
+	nextRun  time.Time
+	lastRun  time.Time
+	running  bool
+	reset    chan struct{}
+}
+
+// Scheduler runs each registered stage on its own interval or cron schedule.
+// A stage never overlaps with itself: the next run is planned once the
+// current one has finished.
+type Scheduler struct {
+	jobs    map[string]*job
+	started bool
+	mu      sync.Mutex
+}
+
+func New() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*job)}
+}
+
+// Register adds a stage. It must be called before Start.
+func (s *Scheduler) Register(name string, schedule models.StageSchedule, run func(ctx context.Context)) error {
+	cron, err := validate(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("scheduler already started")
+	}
+	s.jobs[name] = &job{
+		name:     name,
+		schedule: schedule,
+		cron:     cron,
+		run:      run,
+		reset:    make(chan struct{}, 1),
+	}
+	return nil
+}
+
+// Start runs every stage once and then on its schedule until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = true
+	for _, j := range s.jobs {
+		go s.loop(ctx, j)
+	}
+}
+
+// Update replaces the schedule of a stage at runtime.
+func (s *Scheduler) Update(name string, schedule models.StageSchedule) error {
+	cron, err := validate(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("unknown stage: %s", name)
+	}
+	j.schedule = schedule
+	j.cron = cron
+
+	select {
+	case j.reset <- struct{}{}:
+	default:
+	}
+
+	logger.LogInfo(logPrefix, "Schedule updated", name, schedule)
+	return nil
+}
+
+// Status returns the schedule of every stage, ordered by name.
+func (s *Scheduler) Status() []StageStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]StageStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		statuses = append(statuses, StageStatus{
+			Stage:    j.name,
+			Schedule: j.schedule,
+			NextRun:  j.nextRun,
+			LastRun:  j.lastRun,
+			Running:  j.running,
+		})
+	}
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Stage < statuses[k].Stage
+	})
+	return statuses
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	s.execute(ctx, j)
+
+	for {
+		wait, err := s.plan(j)
+		if err != nil {
+			logger.LogError(logPrefix, "Failed to plan next run, stage stopped", j.name, err)
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			s.execute(ctx, j)
+		case <-j.reset:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			logger.LogInfo(logPrefix, "Stage shutting down", j.name, nil)
+			return
+		}
+	}
+}
+
+// plan works out the delay until the next run of a stage, jitter included.
+func (s *Scheduler) plan(j *job) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	next := now.Add(time.Duration(j.schedule.IntervalSeconds) * time.Second)
+	if j.cron != nil {
+		var err error
+		if next, err = j.cron.next(now); err != nil {
+			return 0, err
+		}
+	}
+	if j.schedule.JitterSeconds > 0 {
+		next = next.Add(rand.N(time.Duration(j.schedule.JitterSeconds) * time.Second))
+	}
+
+	j.nextRun = next
+	return next.Sub(now), nil
+}
+
+func (s *Scheduler) execute(ctx context.Context, j *job) {
+	s.mu.Lock()
+	j.running = true
+	j.lastRun = time.Now()
+	s.mu.Unlock()
+
+	j.run(ctx)
+
+	s.mu.Lock()
+	j.running = false
+	s.mu.Unlock()
+}
+
+func validate(schedule models.StageSchedule) (*cronExpr, error) {
+	if schedule.JitterSeconds < 0 {
+		return nil, fmt.Errorf("jitter must not be negative")
+	}
+	if schedule.Cron != "" {
+		return parseCron(schedule.Cron)
+	}
+	if schedule.IntervalSeconds <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	return nil, nil
+}
@@ -0,0 +1,213 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+const (
+	winCertTypePKCSSignedData = 0x0002
+	// maxCertificateTable bounds the certificate table read from one file.
+	maxCertificateTable = 8 * 1024 * 1024
+)
+
+// PKCS#7 structures, limited to what is needed to find the signing certificate.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// Signer returns the subject of the certificate that signed a file, read
+// from its embedded Authenticode signature or, failing that, from the system
+// catalog that lists it. It does not check trust, use Verify for that. Files
+// without a signature return an empty signer.
+func (v *Verifier) Signer(filePath string) (string, error) {
+	cert, _, err := fileCertificate(filePath)
+	if err != nil || cert == nil {
+		return "", err
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, nil
+	}
+	if len(cert.Subject.Organization) > 0 {
+		return cert.Subject.Organization[0], nil
+	}
+	return cert.Subject.String(), nil
+}
+
+// Summary describes the signature of a file. Catalog is set when the file
+// is signed through a system catalog rather than an embedded signature.
+// Verified is nil where trust could not be checked, as on platforms other
+// than Windows.
+type Summary struct {
+	Signed     bool       `json:"signed"`
+	Catalog    string     `json:"catalog,omitempty"`
+	Verified   *bool      `json:"verified,omitempty"`
+	Subject    string     `json:"subject,omitempty"`
+	Issuer     string     `json:"issuer,omitempty"`
+	Serial     string     `json:"serial,omitempty"`
+	Thumbprint string     `json:"thumbprint,omitempty"`
+	NotBefore  *time.Time `json:"notBefore,omitempty"`
+	NotAfter   *time.Time `json:"notAfter,omitempty"`
+}
+
+// Summary reads the signing certificate of a file and checks trust where
+// the platform supports it.
+func (v *Verifier) Summary(filePath string) (*Summary, error) {
+	cert, catalog, err := fileCertificate(filePath)
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{Catalog: catalog}
+	if cert != nil {
+		summary.Signed = true
+		summary.Subject = cert.Subject.String()
+		summary.Issuer = cert.Issuer.String()
+		summary.Serial = fmt.Sprintf("%x", cert.SerialNumber)
+		summary.Thumbprint = fmt.Sprintf("%x", sha1.Sum(cert.Raw))
+		summary.NotBefore, summary.NotAfter = &cert.NotBefore, &cert.NotAfter
+	}
+	if verified, err := v.Verify(filePath); err == nil {
+		summary.Verified = &verified
+	}
+	return summary, nil
+}
+
+// lookupCatalog finds the system catalog listing a file. Tests replace it.
+var lookupCatalog = catalogFor
+
+// fileCertificate returns the certificate that signed a file, from its
+// embedded signature or else from the catalog that lists it, with the path
+// of that catalog.
+func fileCertificate(filePath string) (*x509.Certificate, string, error) {
+	cert, err := signingCertificate(filePath)
+	if err != nil || cert != nil {
+		return cert, "", err
+	}
+
+	catalog, err := lookupCatalog(filePath)
+	if err != nil || catalog == "" {
+		return nil, "", err
+	}
+	der, err := os.ReadFile(catalog)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read catalog: %w", err)
+	}
+	cert, err = parseSignedData(der)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse catalog %s: %w", catalog, err)
+	}
+	return cert, catalog, nil
+}
+
+func signingCertificate(filePath string) (*x509.Certificate, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	pf, err := pe.NewFile(f)
+	if err != nil {
+		// Not a PE file, so there is no embedded signature.
+		return nil, nil
+	}
+	defer pf.Close()
+
+	var sec pe.DataDirectory
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			sec = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	case *pe.OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			sec = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	}
+	// The security directory holds a file offset rather than an RVA.
+	if sec.VirtualAddress == 0 || sec.Size < 8 {
+		return nil, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if sec.Size > maxCertificateTable || int64(sec.VirtualAddress)+int64(sec.Size) > info.Size() {
+		return nil, fmt.Errorf("certificate table of %d bytes at 0x%x does not fit the file", sec.Size, sec.VirtualAddress)
+	}
+
+	table := make([]byte, sec.Size)
+	if _, err := f.ReadAt(table, int64(sec.VirtualAddress)); err != nil {
+		return nil, fmt.Errorf("failed to read certificate table: %w", err)
+	}
+
+	// WIN_CERTIFICATE: dwLength, wRevision, wCertificateType, bCertificate.
+	length := binary.LittleEndian.Uint32(table[0:])
+	certType := binary.LittleEndian.Uint16(table[6:])
+	if certType != winCertTypePKCSSignedData || length < 8 || int(length) > len(table) {
+		return nil, nil
+	}
+	return parseSignedData(table[8:length])
+}
+
+func parseSignedData(der []byte) (*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse signed data: %w", err)
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, nil
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature certificates: %w", err)
+	}
+
+	signer := sd.SignerInfos[0].IssuerAndSerialNumber
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(signer.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, signer.IssuerName.FullBytes) {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("signing certificate not found in signature")
+}
@@ -0,0 +1,200 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// writeCatalog writes a catalog whose signed data carries a certificate
+// issued to subject, and returns its path.
+func writeCatalog(t *testing.T, subject string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: subject, Organization: []string{"Microsoft Corporation"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := asn1.Marshal(struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      asn1.RawValue{FullBytes: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     issuerAndSerial{IssuerName: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSA},
+			EncryptedDigest:           []byte{1},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Marshal does not add the explicit tag to a raw value, so wrap it here.
+	wrapped, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{FullBytes: wrapped}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "nt5.cat")
+	if err := os.WriteFile(path, der, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// useCatalog makes every file look listed in catalog for the test.
+func useCatalog(t *testing.T, catalog string) {
+	t.Helper()
+	lookupCatalog = func(string) (string, error) { return catalog, nil }
+	t.Cleanup(func() { lookupCatalog = catalogFor })
+}
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notepad.exe")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSignerFromCatalog(t *testing.T) {
+	catalog := writeCatalog(t, "Microsoft Windows")
+	useCatalog(t, catalog)
+	file := writeFile(t, "no embedded signature")
+
+	v := &Verifier{}
+	signer, err := v.Signer(file)
+	if err != nil {
+		t.Fatalf("Signer: %v", err)
+	}
+	if signer != "Microsoft Windows" {
+		t.Errorf("signer = %q, want %q", signer, "Microsoft Windows")
+	}
+
+	summary, err := v.Summary(file)
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if !summary.Signed || summary.Catalog != catalog {
+		t.Errorf("summary = %+v, want signed through %s", summary, catalog)
+	}
+}
+
+func TestSignerWithoutCatalog(t *testing.T) {
+	useCatalog(t, "")
+	file := writeFile(t, "no embedded signature")
+
+	v := &Verifier{}
+	signer, err := v.Signer(file)
+	if err != nil || signer != "" {
+		t.Errorf("Signer = %q, %v, want no signer", signer, err)
+	}
+	summary, err := v.Summary(file)
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if summary.Signed || summary.Catalog != "" {
+		t.Errorf("summary = %+v, want unsigned", summary)
+	}
+}
+
+func TestSignerBadCatalog(t *testing.T) {
+	useCatalog(t, writeFile(t, "not a catalog"))
+	if _, err := (&Verifier{}).Signer(writeFile(t, "no embedded signature")); err == nil {
+		t.Error("expected an error for an unreadable catalog")
+	}
+}
+
+// writePE writes a minimal 64-bit PE file of size bytes whose security
+// directory points at a certificate table of tableSize bytes at offset.
+func writePE(t *testing.T, size int, offset, tableSize uint32) string {
+	t.Helper()
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+
+	header := pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, SizeOfOptionalHeader: 240, Characteristics: pe.IMAGE_FILE_EXECUTABLE_IMAGE}
+	optional := pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	optional.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY] = pe.DataDirectory{VirtualAddress: offset, Size: tableSize}
+	binary.Write(&buf, binary.LittleEndian, header)
+	binary.Write(&buf, binary.LittleEndian, optional)
+	if buf.Len() < size {
+		buf.Write(make([]byte, size-buf.Len()))
+	}
+
+	path := filepath.Join(t.TempDir(), "tool.exe")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSigningCertificateBounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		offset    uint32
+		tableSize uint32
+		wantErr   bool
+	}{
+		{"fits", 0x200, 0x100, false},
+		{"past the end", 0x200, 0x300, true},
+		{"offset past the end", 0x1000, 8, true},
+		{"huge", 0x200, 0xfffffff0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := signingCertificate(writePE(t, 0x400, tt.offset, tt.tableSize))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if cert != nil {
+				t.Errorf("found a certificate in an empty table")
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+// internal/signature/verifier_other.go
+package signature
+
+func isBinarySigned(filePath string) (bool, error) {
+	return false, ErrUnsupported
+}
+
+// catalogFor finds no catalog; only Windows signs files through catalogs.
+func catalogFor(filePath string) (string, error) {
+	return "", nil
+}
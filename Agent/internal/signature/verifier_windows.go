@@ -0,0 +1,247 @@
+// internal/signature/verifier_windows.go
+package signature
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	IMAGE_DOS_SIGNATURE            = 0x5A4D     // "MZ"
+	IMAGE_NT_SIGNATURE             = 0x00004550 // "PE\0\0"
+	IMAGE_DIRECTORY_ENTRY_SECURITY = 4          // Certificate table index
+)
+
+const (
+	WINTRUST_ACTION_GENERIC_VERIFY_V2 = "{00AAC56B-CD44-11d0-8CC2-00C04FC295EE}"
+	WTD_REVOKE_NONE                   = 0
+	WTD_CHOICE_FILE                   = 1
+	WTD_CHOICE_CATALOG                = 2
+	WTD_STATEACTION_VERIFY            = 1
+	WTD_STATEACTION_CLOSE             = 2
+	WTD_UI_NONE                       = 2
+	TRUST_E_NOSIGNATURE               = 0x800B0100
+	TRUST_E_EXPIRED                   = 0x800B0101
+	TRUST_E_PROVIDER_UNKNOWN          = 0x800B0001
+	TRUST_E_BAD_DIGEST                = 0x80096010
+	TRUST_E_SUBJECT_NOT_TRUSTED       = 0x800B0004
+)
+
+type WINTRUST_FILE_INFO struct {
+	StructSize   uint32
+	FilePath     *uint16
+	FileHandle   syscall.Handle
+	KnownSubject *windows.GUID
+}
+
+type WINTRUST_DATA struct {
+	StructSize         uint32
+	PolicyCallbackData uintptr
+	SIPClientData      uintptr
+	UIChoice           uint32
+	RevocationChecks   uint32
+	UnionChoice        uint32
+	FileInfo           uintptr
+	StateAction        uint32
+	StateData          syscall.Handle
+	URLReference       *uint16
+	ProvFlags          uint32
+	UIContext          uint32
+	SignatureSettings  uintptr
+}
+
+var (
+	wintrust                                 = windows.NewLazySystemDLL("wintrust.dll")
+	procWinVerifyTrust                       = wintrust.NewProc("WinVerifyTrust")
+	procCryptCATAdminAcquireContext2         = wintrust.NewProc("CryptCATAdminAcquireContext2")
+	procCryptCATAdminReleaseContext          = wintrust.NewProc("CryptCATAdminReleaseContext")
+	procCryptCATAdminCalcHashFromFileHandle2 = wintrust.NewProc("CryptCATAdminCalcHashFromFileHandle2")
+	procCryptCATAdminEnumCatalogFromHash     = wintrust.NewProc("CryptCATAdminEnumCatalogFromHash")
+	procCryptCATCatalogInfoFromContext       = wintrust.NewProc("CryptCATCatalogInfoFromContext")
+	procCryptCATAdminReleaseCatalogContext   = wintrust.NewProc("CryptCATAdminReleaseCatalogContext")
+)
+
+// WINTRUST_CATALOG_INFO names the catalog listing a file, for verifying
+// files that are signed through a catalog rather than an embedded signature.
+type WINTRUST_CATALOG_INFO struct {
+	StructSize             uint32
+	CatalogVersion         uint32
+	CatalogFilePath        *uint16
+	MemberTag              *uint16
+	MemberFilePath         *uint16
+	MemberFile             syscall.Handle
+	CalculatedFileHash     *byte
+	CalculatedFileHashSize uint32
+	CatalogContext         uintptr
+	CatAdmin               syscall.Handle
+}
+
+type CATALOG_INFO struct {
+	StructSize  uint32
+	CatalogFile [windows.MAX_PATH]uint16
+}
+
+// catalogHashAlgorithms are tried in order; older catalogs list SHA-1 hashes.
+var catalogHashAlgorithms = []string{"SHA256", "SHA1"}
+
+// isBinarySigned checks the embedded signature of a file and, if it has
+// none, the system catalog that lists it. Most inbox Windows binaries are
+// only signed through a catalog.
+func isBinarySigned(filePath string) (bool, error) {
+	filePathPtr, err := syscall.UTF16PtrFromString(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert file path: %v", err)
+	}
+
+	fileInfo := WINTRUST_FILE_INFO{
+		StructSize: uint32(unsafe.Sizeof(WINTRUST_FILE_INFO{})),
+		FilePath:   filePathPtr,
+	}
+	code, err := winVerifyTrust(WTD_CHOICE_FILE, unsafe.Pointer(&fileInfo))
+	if code == TRUST_E_NOSIGNATURE {
+		catalog, hash, catErr := findCatalog(filePath)
+		if catErr != nil {
+			return false, catErr
+		}
+		if catalog != "" {
+			code, err = verifyCatalogMember(filePathPtr, catalog, hash)
+		}
+	}
+
+	if code == 0 {
+		return true, nil
+	}
+	switch code {
+	case TRUST_E_NOSIGNATURE:
+		return false, nil
+	case TRUST_E_EXPIRED:
+		return true, fmt.Errorf("signature is expired")
+	case TRUST_E_PROVIDER_UNKNOWN:
+		return false, fmt.Errorf("unknown trust provider")
+	case TRUST_E_BAD_DIGEST:
+		return true, fmt.Errorf("signature digest is invalid")
+	case TRUST_E_SUBJECT_NOT_TRUSTED:
+		return true, fmt.Errorf("signature is not trusted")
+	default:
+		return false, fmt.Errorf("WinVerifyTrust failed with code 0x%x: %v", code, err)
+	}
+}
+
+// winVerifyTrust runs the generic Authenticode policy on a file or catalog
+// member and returns its result code.
+func winVerifyTrust(choice uint32, info unsafe.Pointer) (uint32, error) {
+	guidAction, err := windows.GUIDFromString(WINTRUST_ACTION_GENERIC_VERIFY_V2)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse GUID: %v", err)
+	}
+
+	var wintrustData WINTRUST_DATA
+	wintrustData.StructSize = uint32(unsafe.Sizeof(wintrustData))
+	wintrustData.UIChoice = WTD_UI_NONE
+	wintrustData.RevocationChecks = WTD_REVOKE_NONE
+	wintrustData.UnionChoice = choice
+	wintrustData.FileInfo = uintptr(info)
+	wintrustData.StateAction = WTD_STATEACTION_VERIFY
+
+	r1, _, err := procWinVerifyTrust.Call(
+		0,
+		uintptr(unsafe.Pointer(&guidAction)),
+		uintptr(unsafe.Pointer(&wintrustData)),
+	)
+
+	wintrustData.StateAction = WTD_STATEACTION_CLOSE
+	procWinVerifyTrust.Call(
+		0,
+		uintptr(unsafe.Pointer(&guidAction)),
+		uintptr(unsafe.Pointer(&wintrustData)),
+	)
+	return uint32(r1), err
+}
+
+// verifyCatalogMember verifies a file against the catalog that lists its
+// hash.
+func verifyCatalogMember(filePathPtr *uint16, catalog string, hash []byte) (uint32, error) {
+	catalogPtr, err := syscall.UTF16PtrFromString(catalog)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert catalog path: %v", err)
+	}
+	tagPtr, err := syscall.UTF16PtrFromString(strings.ToUpper(hex.EncodeToString(hash)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert member tag: %v", err)
+	}
+
+	catalogInfo := WINTRUST_CATALOG_INFO{
+		StructSize:             uint32(unsafe.Sizeof(WINTRUST_CATALOG_INFO{})),
+		CatalogFilePath:        catalogPtr,
+		MemberTag:              tagPtr,
+		MemberFilePath:         filePathPtr,
+		CalculatedFileHash:     &hash[0],
+		CalculatedFileHashSize: uint32(len(hash)),
+	}
+	return winVerifyTrust(WTD_CHOICE_CATALOG, unsafe.Pointer(&catalogInfo))
+}
+
+// catalogFor returns the system catalog that lists the file, if any.
+func catalogFor(filePath string) (string, error) {
+	catalog, _, err := findCatalog(filePath)
+	return catalog, err
+}
+
+// findCatalog looks the hash of a file up in the system catalogs and
+// returns the catalog that lists it with the hash it is listed by.
+func findCatalog(filePath string) (string, []byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	for _, algorithm := range catalogHashAlgorithms {
+		catalog, hash, err := findCatalogByHash(f, algorithm)
+		if err != nil || catalog != "" {
+			return catalog, hash, err
+		}
+	}
+	return "", nil, nil
+}
+
+func findCatalogByHash(f *os.File, algorithm string) (string, []byte, error) {
+	algorithmPtr, err := syscall.UTF16PtrFromString(algorithm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var catAdmin syscall.Handle
+	if r1, _, err := procCryptCATAdminAcquireContext2.Call(uintptr(unsafe.Pointer(&catAdmin)), 0, uintptr(unsafe.Pointer(algorithmPtr)), 0, 0); r1 == 0 {
+		return "", nil, fmt.Errorf("failed to acquire catalog context: %v", err)
+	}
+	defer procCryptCATAdminReleaseContext.Call(uintptr(catAdmin), 0)
+
+	var size uint32
+	procCryptCATAdminCalcHashFromFileHandle2.Call(uintptr(catAdmin), f.Fd(), uintptr(unsafe.Pointer(&size)), 0, 0)
+	if size == 0 {
+		return "", nil, fmt.Errorf("failed to size the %s catalog hash", algorithm)
+	}
+	hash := make([]byte, size)
+	if r1, _, err := procCryptCATAdminCalcHashFromFileHandle2.Call(uintptr(catAdmin), f.Fd(), uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&hash[0])), 0); r1 == 0 {
+		return "", nil, fmt.Errorf("failed to calculate the %s catalog hash: %v", algorithm, err)
+	}
+
+	catInfo, _, _ := procCryptCATAdminEnumCatalogFromHash.Call(uintptr(catAdmin), uintptr(unsafe.Pointer(&hash[0])), uintptr(size), 0, 0)
+	if catInfo == 0 {
+		return "", nil, nil
+	}
+	defer procCryptCATAdminReleaseCatalogContext.Call(uintptr(catAdmin), catInfo, 0)
+
+	info := CATALOG_INFO{StructSize: uint32(unsafe.Sizeof(CATALOG_INFO{}))}
+	if r1, _, err := procCryptCATCatalogInfoFromContext.Call(catInfo, uintptr(unsafe.Pointer(&info)), 0); r1 == 0 {
+		return "", nil, fmt.Errorf("failed to read catalog info: %v", err)
+	}
+	return windows.UTF16ToString(info.CatalogFile[:]), hash, nil
+}
@@ -0,0 +1,48 @@
+//go:build windows
+
+package signature
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// catalogSigned finds a system binary that carries no embedded signature,
+// so that it can only be verified through its catalog.
+func catalogSigned(t *testing.T) string {
+	t.Helper()
+	system := filepath.Join(os.Getenv("SystemRoot"), "System32")
+	for _, name := range []string{"notepad.exe", "cmd.exe", "where.exe", "whoami.exe", "find.exe"} {
+		path := filepath.Join(system, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if cert, err := signingCertificate(path); err == nil && cert == nil {
+			return path
+		}
+	}
+	t.Skip("no catalog-signed system binary found")
+	return ""
+}
+
+func TestVerifyCatalogSigned(t *testing.T) {
+	path := catalogSigned(t)
+	v, err := NewVerifier()
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	signed, err := v.Verify(path)
+	if err != nil || !signed {
+		t.Errorf("Verify(%s) = %v, %v, want signed", path, signed, err)
+	}
+	signer, err := v.Signer(path)
+	if err != nil {
+		t.Fatalf("Signer: %v", err)
+	}
+	if !strings.Contains(signer, "Microsoft") {
+		t.Errorf("Signer(%s) = %q, want a Microsoft signer", path, signer)
+	}
+}
@@ -0,0 +1,196 @@
+package threatintel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// pathIndicator is a compiled filename or path IOC. Exact indicators keep
+// their normalized pattern, globs and regexes keep a compiled expression.
+type pathIndicator struct {
+	indicator models.PathIndicator
+	exact     string
+	re        *regexp.Regexp
+	baseOnly  bool
+}
+
+// resolveFeedPath resolves a feed path relative to the agent directory.
+func resolveFeedPath(directory, feedPath string) string {
+	if filepath.IsAbs(feedPath) {
+		return feedPath
+	}
+	return filepath.Join(directory, feedPath)
+}
+
+func (ti *ThreatIntel) loadPathFeed(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to read path feed", path, err)
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var indicators []models.PathIndicator
+	if err := json.Unmarshal(data, &indicators); err != nil {
+		logger.LogError(logPrefix, "Failed to unmarshal path feed", path, err)
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	for _, ind := range indicators {
+		compiled, err := compilePathIndicator(ind)
+		if err != nil {
+			logger.LogWarning(logPrefix, "Skipping invalid path indicator", ind.Pattern, err)
+			continue
+		}
+		ti.pathIndicators = append(ti.pathIndicators, compiled)
+	}
+
+	logger.LogInfo(logPrefix, "Loaded path feed successfully", path, nil)
+	return nil
+}
+
+// compilePathIndicator prepares an indicator for matching. Patterns without a
+// path separator are matched against the file name only, everything else
+// against the full path. Exact and glob patterns are compared case-insensitively
+// with '\' and '/' treated alike; '*' in a glob may span directories.
+func compilePathIndicator(ind models.PathIndicator) (pathIndicator, error) {
+	if ind.Pattern == "" {
+		return pathIndicator{}, fmt.Errorf("empty pattern")
+	}
+
+	kind := ind.Match
+	if kind == "" {
+		kind = models.PathMatchExact
+		if strings.ContainsAny(ind.Pattern, "*?") {
+			kind = models.PathMatchGlob
+		}
+		ind.Match = kind
+	}
+
+	switch kind {
+	case models.PathMatchExact:
+		pattern := normalizePath(ind.Pattern)
+		return pathIndicator{
+			indicator: ind,
+			exact:     pattern,
+			baseOnly:  !strings.Contains(pattern, "/"),
+		}, nil
+
+	case models.PathMatchGlob:
+		pattern := normalizePath(ind.Pattern)
+		re, err := regexp.Compile(globToRegexp(pattern))
+		if err != nil {
+			return pathIndicator{}, fmt.Errorf("invalid glob: %w", err)
+		}
+		return pathIndicator{
+			indicator: ind,
+			re:        re,
+			baseOnly:  !strings.Contains(pattern, "/"),
+		}, nil
+
+	case models.PathMatchRegex:
+		re, err := regexp.Compile("(?i)" + ind.Pattern)
+		if err != nil {
+			return pathIndicator{}, fmt.Errorf("invalid regex: %w", err)
+		}
+		return pathIndicator{indicator: ind, re: re}, nil
+
+	default:
+		return pathIndicator{}, fmt.Errorf("unsupported match kind: %s", kind)
+	}
+}
+
+func (p pathIndicator) matches(filePath, normalized string) bool {
+	if p.indicator.Match == models.PathMatchRegex {
+		return p.re.MatchString(filePath)
+	}
+
+	subject := normalized
+	if p.baseOnly {
+		subject = path.Base(normalized)
+	}
+	if p.re != nil {
+		return p.re.MatchString(subject)
+	}
+	return subject == p.exact
+}
+
+func normalizePath(p string) string {
+	return strings.ToLower(strings.ReplaceAll(p, `\`, "/"))
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// MatchPath reports the first path indicator matching filePath.
+func (ti *ThreatIntel) MatchPath(filePath string) (models.PathIndicator, bool) {
+	if filePath == "" {
+		return models.PathIndicator{}, false
+	}
+	normalized := normalizePath(filePath)
+
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+
+	for _, ind := range ti.pathIndicators {
+		if ind.matches(filePath, normalized) {
+			logger.LogInfo(logPrefix, "Path indicator matched", filePath, ind.indicator.Pattern)
+			return ind.indicator, true
+		}
+	}
+	return models.PathIndicator{}, false
+}
+
+// PathMatcher matches paths against a set of patterns using the same rules
+// as the path feed.
+type PathMatcher struct {
+	patterns []pathIndicator
+}
+
+// CompilePathPatterns compiles exact or glob patterns into a PathMatcher.
+func CompilePathPatterns(patterns []string) (*PathMatcher, error) {
+	m := &PathMatcher{}
+	for _, pattern := range patterns {
+		compiled, err := compilePathIndicator(models.PathIndicator{Pattern: pattern})
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+		}
+		m.patterns = append(m.patterns, compiled)
+	}
+	return m, nil
+}
+
+// Match reports whether filePath matches any of the patterns.
+func (m *PathMatcher) Match(filePath string) bool {
+	if filePath == "" {
+		return false
+	}
+	normalized := normalizePath(filePath)
+	for _, p := range m.patterns {
+		if p.matches(filePath, normalized) {
+			return true
+		}
+	}
+	return false
+}
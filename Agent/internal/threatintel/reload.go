@@ -0,0 +1,167 @@
+package threatintel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// IndicatorDelta holds the indicators that appeared in a feed reload.
+type IndicatorDelta struct {
+	AddedHashes []string               `json:"addedHashes"`
+	AddedPaths  []models.PathIndicator `json:"addedPaths"`
+	LoadedAt    time.Time              `json:"loadedAt"`
+
+	hashes map[string]bool
+	paths  []pathIndicator
+}
+
+// Empty reports whether the reload added no indicators.
+func (d IndicatorDelta) Empty() bool {
+	return len(d.AddedHashes) == 0 && len(d.AddedPaths) == 0
+}
+
+// MatchHash reports which newly added hash, if any, matches a file.
+func (d IndicatorDelta) MatchHash(md5Hash, sha256Hash string) (string, bool) {
+	if d.hashes[md5Hash] {
+		return md5Hash, true
+	}
+	if d.hashes[sha256Hash] {
+		return sha256Hash, true
+	}
+	return "", false
+}
+
+// MatchPath reports which newly added path indicator, if any, matches a file.
+func (d IndicatorDelta) MatchPath(filePath string) (models.PathIndicator, bool) {
+	normalized := normalizePath(filePath)
+	for _, ind := range d.paths {
+		if ind.matches(filePath, normalized) {
+			return ind.indicator, true
+		}
+	}
+	return models.PathIndicator{}, false
+}
+
+// OnUpdate registers a callback invoked with the added indicators after every
+// reload that changed the feeds.
+func (ti *ThreatIntel) OnUpdate(fn func(IndicatorDelta)) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.listeners = append(ti.listeners, fn)
+}
+
+// Reload re-reads every feed and swaps the indicator set in one step. The
+// previous indicators stay active if any feed fails to load.
+func (ti *ThreatIntel) Reload() (IndicatorDelta, error) {
+	logger.LogInfo(logPrefix, "Reloading threat data", ti.directory, nil)
+
+	fresh := &ThreatIntel{
+		config:          ti.config,
+		maliciousHashes: make(map[string]bool),
+	}
+	if err := fresh.loadThreatData(ti.directory); err != nil {
+		logger.LogError(logPrefix, "Failed to reload threat data", ti.directory, err)
+		return IndicatorDelta{}, fmt.Errorf("failed to reload threat data: %w", err)
+	}
+
+	delta := IndicatorDelta{
+		LoadedAt: time.Now(),
+		hashes:   make(map[string]bool),
+	}
+
+	ti.mu.Lock()
+	for hash := range fresh.maliciousHashes {
+		if !ti.maliciousHashes[hash] {
+			delta.hashes[hash] = true
+			delta.AddedHashes = append(delta.AddedHashes, hash)
+		}
+	}
+
+	known := make(map[models.PathIndicator]bool, len(ti.pathIndicators))
+	for _, ind := range ti.pathIndicators {
+		known[ind.indicator] = true
+	}
+	for _, ind := range fresh.pathIndicators {
+		if !known[ind.indicator] {
+			delta.paths = append(delta.paths, ind)
+			delta.AddedPaths = append(delta.AddedPaths, ind.indicator)
+		}
+	}
+
+	ti.maliciousHashes = fresh.maliciousHashes
+	ti.pathIndicators = fresh.pathIndicators
+	listeners := append([]func(IndicatorDelta){}, ti.listeners...)
+	ti.mu.Unlock()
+
+	logger.LogInfo(logPrefix, fmt.Sprintf("Threat data reloaded - %d new hashes, %d new path indicators", len(delta.AddedHashes), len(delta.AddedPaths)), "", nil)
+
+	if !delta.Empty() {
+		for _, fn := range listeners {
+			fn(delta)
+		}
+	}
+	return delta, nil
+}
+
+// StartWatching polls the feed files and reloads them whenever one changes.
+func (ti *ThreatIntel) StartWatching(ctx context.Context) {
+	interval := ti.config.ReloadIntervalSeconds
+	if interval <= 0 {
+		interval = models.DefaultFeedReloadInterval
+	}
+	go ti.watchFeeds(ctx, time.Duration(interval)*time.Second)
+}
+
+func (ti *ThreatIntel) watchFeeds(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ti.feedModTimes()
+	for {
+		select {
+		case <-ticker.C:
+			current := ti.feedModTimes()
+			if !sameModTimes(last, current) {
+				if _, err := ti.Reload(); err != nil {
+					// Keep the old snapshot so the reload is retried on the next tick.
+					continue
+				}
+				last = current
+			}
+		case <-ctx.Done():
+			logger.LogInfo(logPrefix, "Feed watcher shutting down", "", nil)
+			return
+		}
+	}
+}
+
+func (ti *ThreatIntel) feedModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(ti.config.Feeds))
+	for _, feed := range ti.config.Feeds {
+		path := feedPath(ti.directory, feed)
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.LogWarning(logPrefix, "Failed to stat feed", path, err)
+			continue
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if !b[path].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
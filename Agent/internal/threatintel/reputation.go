@@ -0,0 +1,285 @@
+package threatintel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+)
+
+// Verdict is the reputation of a single file hash.
+type Verdict struct {
+	Hash      string    `json:"hash"`
+	Malicious bool      `json:"malicious"`
+	Type      string    `json:"type,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// ReputationProvider looks up hashes that are not known to the local feeds.
+// Hashes missing from the returned map have no verdict.
+type ReputationProvider interface {
+	Lookup(ctx context.Context, hashes []string) (map[string]Verdict, error)
+}
+
+type reputationRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+type reputationResponse struct {
+	Verdicts []Verdict `json:"verdicts"`
+}
+
+// HTTPReputationProvider queries a reputation service over HTTP. Each batch is
+// POSTed as {"hashes": [...]} and answered with {"verdicts": [...]}. Verdicts
+// are cached on disk so a hash is only asked about again once its TTL expires.
+type HTTPReputationProvider struct {
+	config   *models.ReputationConfig
+	client   *http.Client
+	cache    *verdictCache
+	interval time.Duration
+
+	lastRequest time.Time
+	rateMu      sync.Mutex
+}
+
+func NewHTTPReputationProvider(cfg *models.ReputationConfig, directory string) (*HTTPReputationProvider, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("reputation url is not configured")
+	}
+
+	timeout := cfg.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = models.DefaultReputationTimeout
+	}
+	perMinute := cfg.RequestsPerMinute
+	if perMinute <= 0 {
+		perMinute = models.DefaultReputationRatePerMin
+	}
+	ttl := cfg.CacheTTLSeconds
+	if ttl <= 0 {
+		ttl = models.DefaultReputationCacheTTL
+	}
+
+	var cachePath string
+	if cfg.CachePath != "" {
+		cachePath = resolveFeedPath(directory, cfg.CachePath)
+	}
+
+	return &HTTPReputationProvider{
+		config:   cfg,
+		client:   &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		cache:    newVerdictCache(cachePath, time.Duration(ttl)*time.Second),
+		interval: time.Minute / time.Duration(perMinute),
+	}, nil
+}
+
+func (p *HTTPReputationProvider) Lookup(ctx context.Context, hashes []string) (map[string]Verdict, error) {
+	verdicts, missing := p.cache.get(hashes)
+	if len(missing) == 0 {
+		return verdicts, nil
+	}
+
+	batchSize := p.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = models.DefaultReputationBatchSize
+	}
+
+	var fetched []Verdict
+	var lookupErr error
+	for start := 0; start < len(missing); start += batchSize {
+		end := start + batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		batch, err := p.lookupBatch(ctx, missing[start:end])
+		if err != nil {
+			logger.LogError(logPrefix, "Reputation lookup failed", p.config.URL, err)
+			lookupErr = err
+			break
+		}
+		fetched = append(fetched, batch...)
+	}
+
+	for _, v := range fetched {
+		verdicts[v.Hash] = v
+	}
+	if len(fetched) > 0 {
+		p.cache.put(fetched)
+	}
+
+	return verdicts, lookupErr
+}
+
+func (p *HTTPReputationProvider) lookupBatch(ctx context.Context, hashes []string) ([]Verdict, error) {
+	if err := p.waitForSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(reputationRequest{Hashes: hashes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.config.APIKey != "" {
+		header := p.config.APIKeyHeader
+		if header == "" {
+			header = models.DefaultReputationAPIKeyHeader
+		}
+		req.Header.Set(header, p.config.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var result reputationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	now := time.Now()
+	verdicts := make([]Verdict, 0, len(result.Verdicts))
+	for _, v := range result.Verdicts {
+		if v.Hash == "" {
+			continue
+		}
+		v.Hash = strings.ToLower(v.Hash)
+		v.CheckedAt = now
+		verdicts = append(verdicts, v)
+	}
+	return verdicts, nil
+}
+
+// waitForSlot spaces requests evenly so the configured rate is never exceeded.
+func (p *HTTPReputationProvider) waitForSlot(ctx context.Context) error {
+	p.rateMu.Lock()
+	defer p.rateMu.Unlock()
+
+	if wait := time.Until(p.lastRequest.Add(p.interval)); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	p.lastRequest = time.Now()
+	return nil
+}
+
+// verdictCache keeps verdicts in memory and mirrors them to a JSON file.
+type verdictCache struct {
+	path     string
+	ttl      time.Duration
+	verdicts map[string]Verdict
+	mu       sync.Mutex
+}
+
+func newVerdictCache(path string, ttl time.Duration) *verdictCache {
+	c := &verdictCache{
+		path:     path,
+		ttl:      ttl,
+		verdicts: make(map[string]Verdict),
+	}
+	if path == "" {
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.LogWarning(logPrefix, "Failed to read verdict cache", path, err)
+		}
+		return c
+	}
+
+	var verdicts []Verdict
+	if err := json.Unmarshal(data, &verdicts); err != nil {
+		logger.LogWarning(logPrefix, "Discarding unreadable verdict cache", path, err)
+		return c
+	}
+	for _, v := range verdicts {
+		if !c.expired(v) {
+			c.verdicts[v.Hash] = v
+		}
+	}
+	return c
+}
+
+func (c *verdictCache) expired(v Verdict) bool {
+	return time.Since(v.CheckedAt) > c.ttl
+}
+
+func (c *verdictCache) get(hashes []string) (map[string]Verdict, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := make(map[string]Verdict)
+	var missing []string
+	for _, hash := range hashes {
+		if v, ok := c.verdicts[hash]; ok && !c.expired(v) {
+			found[hash] = v
+			continue
+		}
+		missing = append(missing, hash)
+	}
+	return found, missing
+}
+
+func (c *verdictCache) put(verdicts []Verdict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, v := range verdicts {
+		c.verdicts[v.Hash] = v
+	}
+	if c.path == "" {
+		return
+	}
+
+	entries := make([]Verdict, 0, len(c.verdicts))
+	for hash, v := range c.verdicts {
+		if c.expired(v) {
+			delete(c.verdicts, hash)
+			continue
+		}
+		entries = append(entries, v)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		logger.LogError(logPrefix, "Failed to marshal verdict cache", c.path, err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		logger.LogError(logPrefix, "Failed to create verdict cache directory", c.path, err)
+		return
+	}
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		logger.LogError(logPrefix, "Failed to write verdict cache", c.path, err)
+	}
+}
@@ -0,0 +1,323 @@
+package threatintel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhaiFi/security-monitor/internal/logger"
+	"github.com/bhaiFi/security-monitor/pkg/models"
+	"go.uber.org/zap"
+)
+
+// reputationServer is a stand-in reputation service. It marks hashes that
+// start with "bad" as malicious and records every batch it is asked about.
+type reputationServer struct {
+	*httptest.Server
+	batches [][]string
+	headers []http.Header
+	fail    func(request int) int
+	mu      sync.Mutex
+}
+
+func newReputationServer(t *testing.T) *reputationServer {
+	t.Helper()
+	logger.Logging = zap.NewNop()
+
+	rs := &reputationServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req reputationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rs.mu.Lock()
+		rs.batches = append(rs.batches, req.Hashes)
+		rs.headers = append(rs.headers, r.Header.Clone())
+		request := len(rs.batches)
+		fail := rs.fail
+		rs.mu.Unlock()
+
+		if fail != nil {
+			if status := fail(request); status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+
+		var resp reputationResponse
+		for _, hash := range req.Hashes {
+			v := Verdict{Hash: strings.ToUpper(hash)}
+			if strings.HasPrefix(hash, "bad") {
+				v.Malicious = true
+				v.Type = "trojan"
+			}
+			resp.Verdicts = append(resp.Verdicts, v)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func (rs *reputationServer) requests() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return len(rs.batches)
+}
+
+// received returns the batches and headers of the requests so far.
+func (rs *reputationServer) received() ([][]string, []http.Header) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([][]string(nil), rs.batches...), append([]http.Header(nil), rs.headers...)
+}
+
+func (rs *reputationServer) setFail(fail func(request int) int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.fail = fail
+}
+
+func newTestProvider(t *testing.T, cfg models.ReputationConfig) *HTTPReputationProvider {
+	t.Helper()
+	if cfg.RequestsPerMinute == 0 {
+		cfg.RequestsPerMinute = 60000
+	}
+	p, err := NewHTTPReputationProvider(&cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewHTTPReputationProvider: %v", err)
+	}
+	return p
+}
+
+func TestReputationRequiresURL(t *testing.T) {
+	if _, err := NewHTTPReputationProvider(&models.ReputationConfig{}, t.TempDir()); err == nil {
+		t.Fatal("expected an error without a url")
+	}
+}
+
+func TestReputationBatches(t *testing.T) {
+	rs := newReputationServer(t)
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, BatchSize: 2, APIKey: "secret"})
+
+	hashes := []string{"bad1", "good1", "bad2", "good2", "good3"}
+	verdicts, err := p.Lookup(context.Background(), hashes)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+
+	batches, headers := rs.received()
+	if len(batches) != 3 {
+		t.Fatalf("got %d requests, want 3", len(batches))
+	}
+	for i, batch := range batches {
+		if len(batch) > 2 {
+			t.Errorf("batch %d has %d hashes, want at most 2", i, len(batch))
+		}
+		if got := headers[i].Get(models.DefaultReputationAPIKeyHeader); got != "secret" {
+			t.Errorf("batch %d api key = %q, want %q", i, got, "secret")
+		}
+	}
+
+	if len(verdicts) != len(hashes) {
+		t.Fatalf("got %d verdicts, want %d", len(verdicts), len(hashes))
+	}
+	for _, hash := range hashes {
+		v, ok := verdicts[hash]
+		if !ok {
+			t.Errorf("no verdict for %s", hash)
+			continue
+		}
+		if v.Malicious != strings.HasPrefix(hash, "bad") {
+			t.Errorf("%s malicious = %v", hash, v.Malicious)
+		}
+		if v.CheckedAt.IsZero() {
+			t.Errorf("%s has no check time", hash)
+		}
+	}
+}
+
+func TestReputationAPIKeyHeader(t *testing.T) {
+	rs := newReputationServer(t)
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, APIKey: "secret", APIKeyHeader: "Authorization"})
+
+	if _, err := p.Lookup(context.Background(), []string{"good1"}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	_, headers := rs.received()
+	if got := headers[0].Get("Authorization"); got != "secret" {
+		t.Errorf("Authorization = %q, want %q", got, "secret")
+	}
+	if got := headers[0].Get(models.DefaultReputationAPIKeyHeader); got != "" {
+		t.Errorf("default header was also set to %q", got)
+	}
+}
+
+func TestReputationRateLimit(t *testing.T) {
+	rs := newReputationServer(t)
+	// 600 requests per minute spaces requests 100ms apart.
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, BatchSize: 1, RequestsPerMinute: 600})
+
+	start := time.Now()
+	if _, err := p.Lookup(context.Background(), []string{"a", "b", "c", "d"}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if took := time.Since(start); took < 300*time.Millisecond {
+		t.Errorf("4 requests took %s, want at least 300ms", took)
+	}
+	if rs.requests() != 4 {
+		t.Errorf("got %d requests, want 4", rs.requests())
+	}
+}
+
+func TestReputationRateLimitCancel(t *testing.T) {
+	rs := newReputationServer(t)
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, BatchSize: 1, RequestsPerMinute: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	verdicts, err := p.Lookup(ctx, []string{"a", "b"})
+	if err == nil {
+		t.Fatal("expected the lookup to be cancelled while waiting for the rate limit")
+	}
+	if rs.requests() != 1 {
+		t.Errorf("got %d requests, want 1", rs.requests())
+	}
+	if _, ok := verdicts["a"]; !ok {
+		t.Error("verdict of the first batch was dropped")
+	}
+}
+
+func TestReputationCache(t *testing.T) {
+	rs := newReputationServer(t)
+	cachePath := filepath.Join(t.TempDir(), "verdicts.json")
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, CachePath: cachePath})
+
+	if _, err := p.Lookup(context.Background(), []string{"bad1", "good1"}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	verdicts, err := p.Lookup(context.Background(), []string{"bad1", "good1"})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if rs.requests() != 1 {
+		t.Errorf("cached hashes were asked about again: %d requests", rs.requests())
+	}
+	if !verdicts["bad1"].Malicious {
+		t.Error("cached verdict lost its result")
+	}
+
+	// Only the hash missing from the cache is sent.
+	if _, err := p.Lookup(context.Background(), []string{"bad1", "good2"}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	batches, _ := rs.received()
+	if got := batches[len(batches)-1]; len(got) != 1 || got[0] != "good2" {
+		t.Errorf("sent %v, want [good2]", got)
+	}
+
+	// A new provider picks the verdicts up from disk.
+	reloaded := newTestProvider(t, models.ReputationConfig{URL: rs.URL, CachePath: cachePath})
+	before := rs.requests()
+	verdicts, err = reloaded.Lookup(context.Background(), []string{"bad1", "good1", "good2"})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if rs.requests() != before {
+		t.Errorf("verdicts cached on disk were asked about again")
+	}
+	if len(verdicts) != 3 || !verdicts["bad1"].Malicious {
+		t.Errorf("reloaded verdicts = %+v", verdicts)
+	}
+}
+
+func TestReputationCacheExpiry(t *testing.T) {
+	rs := newReputationServer(t)
+	cachePath := filepath.Join(t.TempDir(), "verdicts.json")
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, CachePath: cachePath})
+	p.cache.ttl = 50 * time.Millisecond
+
+	if _, err := p.Lookup(context.Background(), []string{"bad1"}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := p.Lookup(context.Background(), []string{"bad1"}); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if rs.requests() != 2 {
+		t.Errorf("expired verdict was not asked about again: %d requests", rs.requests())
+	}
+
+	// Expired verdicts are not loaded from disk.
+	time.Sleep(100 * time.Millisecond)
+	cache := newVerdictCache(cachePath, 50*time.Millisecond)
+	if len(cache.verdicts) != 0 {
+		t.Errorf("loaded %d expired verdicts", len(cache.verdicts))
+	}
+}
+
+func TestReputationErrors(t *testing.T) {
+	rs := newReputationServer(t)
+	rs.setFail(func(request int) int {
+		if request == 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	p := newTestProvider(t, models.ReputationConfig{URL: rs.URL, BatchSize: 1})
+
+	verdicts, err := p.Lookup(context.Background(), []string{"bad1", "bad2", "bad3"})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("err = %v, want the unexpected status", err)
+	}
+	if rs.requests() != 2 {
+		t.Errorf("lookup went on after a failed batch: %d requests", rs.requests())
+	}
+	if len(verdicts) != 1 || !verdicts["bad1"].Malicious {
+		t.Errorf("verdicts = %+v, want the first batch only", verdicts)
+	}
+
+	// Failed hashes are not cached, so they are asked about again.
+	rs.setFail(nil)
+	verdicts, err = p.Lookup(context.Background(), []string{"bad1", "bad2", "bad3"})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(verdicts) != 3 {
+		t.Errorf("got %d verdicts, want 3", len(verdicts))
+	}
+}
+
+func TestReputationBadResponse(t *testing.T) {
+	logger.Logging = zap.NewNop()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	p := newTestProvider(t, models.ReputationConfig{URL: server.URL})
+	if _, err := p.Lookup(context.Background(), []string{"good1"}); err == nil {
+		t.Fatal("expected an error for an unreadable response")
+	}
+}
+
+func TestReputationUnreachable(t *testing.T) {
+	logger.Logging = zap.NewNop()
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	p := newTestProvider(t, models.ReputationConfig{URL: url, TimeoutSeconds: 1})
+	if _, err := p.Lookup(context.Background(), []string{"good1"}); err == nil {
+		t.Fatal("expected an error for an unreachable service")
+	}
+}
@@ -19,7 +19,11 @@ const logPrefix = "threatintel"
 
 type ThreatIntel struct {
 	config          *models.ThreatIntelConfig
+	directory       string
 	maliciousHashes map[string]bool
+	pathIndicators  []pathIndicator
+	listeners       []func(IndicatorDelta)
+	reputation      ReputationProvider
 	mu              sync.RWMutex
 }
 
@@ -28,6 +32,7 @@ func NewThreatIntel(cfg *models.Config) (*ThreatIntel, error) {
 
 	ti := &ThreatIntel{
 		config:          cfg.ThreatIntel,
+		directory:       cfg.RunningDirectory,
 		maliciousHashes: make(map[string]bool),
 	}
 
@@ -36,6 +41,16 @@ func NewThreatIntel(cfg *models.Config) (*ThreatIntel, error) {
 		return nil, fmt.Errorf("failed to load threat data: %w", err)
 	}
 
+	if rc := cfg.ThreatIntel.Reputation; rc != nil && rc.Enabled {
+		provider, err := NewHTTPReputationProvider(rc, cfg.RunningDirectory)
+		if err != nil {
+			logger.LogError(logPrefix, "Failed to initialize reputation provider", rc.URL, err)
+			return nil, fmt.Errorf("failed to initialize reputation provider: %w", err)
+		}
+		ti.reputation = provider
+		logger.LogInfo(logPrefix, "Reputation provider enabled", rc.URL, nil)
+	}
+
 	logger.LogInfo(logPrefix, "ThreatIntel initialized successfully", "", nil)
 	return ti, nil
 }
@@ -47,20 +62,26 @@ func (ti *ThreatIntel) loadThreatData(directory string) error {
 	defer ti.mu.Unlock()
 
 	for _, feed := range ti.config.Feeds {
+		path := feedPath(directory, feed)
 		switch feed.Format {
 		case "json":
-			path := fmt.Sprintf("%v/data/malware_hashes.json", directory)
 			logger.LogInfo(logPrefix, "Loading JSON feed", path, nil)
 			if err := ti.loadJSONFeed(path); err != nil {
 				logger.LogError(logPrefix, "Failed to load JSON feed", path, err)
 				return fmt.Errorf("failed to load JSON feed: %w", err)
 			}
 		case "csv":
-			logger.LogInfo(logPrefix, "Loading CSV feed", feed.Path, nil)
-			if err := ti.loadCSVFeed(feed.Path); err != nil {
-				logger.LogError(logPrefix, "Failed to load CSV feed", feed.Path, err)
+			logger.LogInfo(logPrefix, "Loading CSV feed", path, nil)
+			if err := ti.loadCSVFeed(path); err != nil {
+				logger.LogError(logPrefix, "Failed to load CSV feed", path, err)
 				return fmt.Errorf("failed to load CSV feed: %w", err)
 			}
+		case "path_json":
+			logger.LogInfo(logPrefix, "Loading path indicator feed", path, nil)
+			if err := ti.loadPathFeed(path); err != nil {
+				logger.LogError(logPrefix, "Failed to load path indicator feed", path, err)
+				return fmt.Errorf("failed to load path indicator feed: %w", err)
+			}
 		default:
 			err := fmt.Errorf("unsupported feed format: %s", feed.Format)
 			logger.LogError(logPrefix, "Unsupported feed format", feed.Format, err)
@@ -71,6 +92,18 @@ func (ti *ThreatIntel) loadThreatData(directory string) error {
 	return nil
 }
 
+// feedPath returns the file a feed is loaded from.
+func feedPath(directory string, feed models.ThreatFeed) string {
+	switch feed.Format {
+	case "json":
+		return fmt.Sprintf("%v/data/malware_hashes.json", directory)
+	case "csv":
+		return feed.Path
+	default:
+		return resolveFeedPath(directory, feed.Path)
+	}
+}
+
 func (ti *ThreatIntel) loadJSONFeed(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -139,16 +172,13 @@ func (ti *ThreatIntel) loadCSVFeed(path string) error {
 }
 
 func (ti *ThreatIntel) IsMalicious(filePath string) bool {
-	md5Hash, sha256Hash, err := calculateFileHashes(filePath)
+	md5Hash, sha256Hash, err := CalculateFileHashes(filePath)
 	if err != nil {
 		logger.LogError(logPrefix, "Failed to calculate file hashes", filePath, err)
 		return false
 	}
 
-	ti.mu.RLock()
-	defer ti.mu.RUnlock()
-
-	if ti.maliciousHashes[md5Hash] || ti.maliciousHashes[sha256Hash] {
+	if ti.IsMaliciousHash(md5Hash, sha256Hash) {
 		logger.LogInfo(logPrefix, "Malicious file detected", filePath, nil)
 		return true
 	}
@@ -157,7 +187,29 @@ func (ti *ThreatIntel) IsMalicious(filePath string) bool {
 	return false
 }
 
-func calculateFileHashes(filePath string) (string, string, error) {
+// SetReputationProvider replaces the provider consulted for unknown hashes.
+func (ti *ThreatIntel) SetReputationProvider(provider ReputationProvider) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.reputation = provider
+}
+
+// Reputation returns the configured reputation provider, or nil if none is set.
+func (ti *ThreatIntel) Reputation() ReputationProvider {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	return ti.reputation
+}
+
+// IsMaliciousHash reports whether either hash of a file is a known indicator.
+func (ti *ThreatIntel) IsMaliciousHash(md5Hash, sha256Hash string) bool {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+
+	return ti.maliciousHashes[md5Hash] || ti.maliciousHashes[sha256Hash]
+}
+
+func CalculateFileHashes(filePath string) (string, string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		logger.LogError(logPrefix, "Failed to open file for hash calculation", filePath, err)
@@ -1,3 +1,147 @@
 package models
 
 const TimeInterval = 600
+
+// Scan stages driven by the scheduler.
+const (
+	StageProcess     = "process"
+	StageFilesystem  = "filesystem"
+	StageNetwork     = "network"
+	StagePersistence = "persistence"
+)
+
+// DefaultFeedReloadInterval is how often, in seconds, feed files are checked for changes.
+const DefaultFeedReloadInterval = 300
+
+// DefaultHistorySize bounds the executed-binary history kept for retro-hunting.
+const DefaultHistorySize = 10000
+
+// DefaultChangeBufferSize bounds the scan-to-scan changes kept for changesSince.
+const DefaultChangeBufferSize = 5000
+
+// Defaults for the external hash reputation lookup.
+const (
+	DefaultReputationBatchSize    = 100
+	DefaultReputationRatePerMin   = 60
+	DefaultReputationCacheTTL     = 86400
+	DefaultReputationTimeout      = 10
+	DefaultReputationAPIKeyHeader = "X-API-Key"
+)
+
+// Defaults for the filesystem scan of the sensitive directories.
+const (
+	DefaultFilesystemWorkers = 4
+	DefaultMaxFileSizeMB     = 100
+)
+
+// Defaults for the scan resource governor.
+const (
+	DefaultGovernorWorkers   = 2
+	DefaultPartialHashMB     = 16
+	DefaultBackoffSeconds    = 5
+	DefaultMaxBackoffSeconds = 60
+)
+
+// MaxHistoryQueryLimit bounds the records returned by a history query.
+const MaxHistoryQueryLimit = 10000
+
+// DefaultDebounceMillis is how long a changed file must stay quiet before the
+// real-time watcher checks it.
+const DefaultDebounceMillis = 2000
+
+// Defaults for the process start/exit event collector.
+const (
+	DefaultProcessEventBuffer = 1000
+	DefaultProcessPollMillis  = 250
+	DefaultExitGraceSeconds   = 300
+)
+
+// Process source types for monitor.process_source.
+const (
+	ProcessSourceAuto     = "auto"
+	ProcessSourceProcfs   = "procfs"
+	ProcessSourceGopsutil = "gopsutil"
+	ProcessSourceReplay   = "replay"
+)
+
+// DefaultMaxEditDistance is how many edits away from a system binary a
+// process name is reported as a typosquat.
+const DefaultMaxEditDistance = 1
+
+// Severities accepted for relationship rules, lowest first.
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// ExecutableExtensions are the file types whose signature is verified by the
+// filesystem scan.
+var ExecutableExtensions = []string{".exe", ".dll", ".sys", ".scr", ".ocx", ".cpl", ".drv", ".com", ".msi"}
+
+// DefaultTrainingHours is how long the learned baseline is trained before
+// it reports anomalies.
+const DefaultTrainingHours = 168
+
+// MaxAnomalies bounds the learned-baseline anomalies kept in memory.
+const MaxAnomalies = 1000
+
+// MaxRiskScore caps the per-process risk score.
+const MaxRiskScore = 100
+
+// DefaultRiskWeights apply when monitor.risk.weights is not set.
+var DefaultRiskWeights = RiskWeights{
+	Unsigned:           15,
+	MaliciousHash:      100,
+	PathIndicator:      60,
+	Reputation:         80,
+	Relationship:       30,
+	WritableLocation:   15,
+	Masquerade:         40,
+	Image:              40,
+	Module:             25,
+	Anomaly:            15,
+	Listener:           5,
+	ExternalConnection: 10,
+	Packed:             30,
+	HighEntropy:        20,
+	WritableExecutable: 20,
+	EntryOutsideText:   15,
+	Overlay:            5,
+	NoImports:          5,
+	WritableRPath:      30,
+	UnusualInterpreter: 30,
+	StaticInUserDir:    15,
+	Setuid:             25,
+	FileCapabilities:   20,
+}
+
+// MaxStaticAnalyses bounds the static analysis results kept by hash.
+const MaxStaticAnalyses = 10000
+
+// DefaultWritablePaths are the temporary and user-writable directories
+// malware is commonly dropped into.
+var DefaultWritablePaths = []string{
+	`*\appdata\local\temp\*`,
+	`*\appdata\roaming\*`,
+	`*\windows\temp\*`,
+	`*\users\public\*`,
+	`*\downloads\*`,
+	`*\$recycle.bin\*`,
+	"/tmp/*",
+	"/var/tmp/*",
+	"/dev/shm/*",
+	"/run/user/*",
+	"/home/*",
+}
+
+// MaxRetroHuntHits bounds the retro-hunt findings kept in memory.
+const MaxRetroHuntHits = 1000
+
+// Match kinds accepted for path and filename indicators.
+const (
+	PathMatchExact = "exact"
+	PathMatchGlob  = "glob"
+	PathMatchRegex = "regex"
+)
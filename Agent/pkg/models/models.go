@@ -7,13 +7,214 @@ type Config struct {
 }
 
 type MonitorConfig struct {
-	IntervalSeconds int      `yaml:"interval_seconds"`
-	SensitiveDirs   []string `yaml:"sensitive_dirs"`
-	GrpcPort        string   `yaml:"grpc_port"`
+	IntervalSeconds   int                  `yaml:"interval_seconds"`
+	SensitiveDirs     []string             `yaml:"sensitive_dirs"`
+	GrpcPort          string               `yaml:"grpc_port"`
+	HistorySize       int                  `yaml:"history_size"`
+	ChangeBufferSize  int                  `yaml:"change_buffer_size"`
+	Schedule          *ScheduleConfig      `yaml:"schedule"`
+	Filesystem        *FilesystemScan      `yaml:"filesystem"`
+	Realtime          *RealtimeConfig      `yaml:"realtime"`
+	ProcessEvents     *ProcessEvents       `yaml:"process_events"`
+	RelationshipRules string               `yaml:"relationship_rules"`
+	ProcessSource     *ProcessSourceConfig `yaml:"process_source"`
+	Modules           *ModuleScan          `yaml:"modules"`
+	Persistence       *PersistenceScan     `yaml:"persistence"`
+	Masquerade        *MasqueradeConfig    `yaml:"masquerade"`
+	ImageChecks       *ImageChecks         `yaml:"image_checks"`
+	Learning          *LearningConfig      `yaml:"learning"`
+	Risk              *RiskConfig          `yaml:"risk"`
+	StaticAnalysis    *StaticAnalysis      `yaml:"static_analysis"`
+	Governor          *GovernorConfig      `yaml:"governor"`
+	HistoryStore      *HistoryStore        `yaml:"history_store"`
+}
+
+// HistoryStore keeps every scan's findings, the process and connection
+// snapshots and the real-time events in a local database at Path. Records
+// older than RetentionDays are deleted, and then the oldest records beyond
+// MaxRecords. A zero limit is not enforced.
+type HistoryStore struct {
+	Enabled       bool   `yaml:"enabled"`
+	Path          string `yaml:"path"`
+	RetentionDays int    `yaml:"retention_days"`
+	MaxRecords    int    `yaml:"max_records"`
+}
+
+// GovernorConfig limits the resources the scans use. MaxWorkers bounds the
+// files hashed and verified at once and HashMBPerSecond the hashing rate.
+// Files over MaxHashSizeMB get a partial hash of their first PartialHashMB.
+// Scans back off, from BackoffSeconds doubling up to MaxBackoffSeconds,
+// while the load average per CPU or the agent's CPU use (100 per core) is
+// over its limit. A zero rate, ceiling or limit is not enforced.
+type GovernorConfig struct {
+	MaxWorkers         int     `yaml:"max_workers"`
+	HashMBPerSecond    int64   `yaml:"hash_mb_per_second"`
+	MaxHashSizeMB      int64   `yaml:"max_hash_size_mb"`
+	PartialHashMB      int64   `yaml:"partial_hash_mb"`
+	MaxLoadPerCPU      float64 `yaml:"max_load_per_cpu"`
+	MaxAgentCPUPercent float64 `yaml:"max_agent_cpu_percent"`
+	BackoffSeconds     int     `yaml:"backoff_seconds"`
+	MaxBackoffSeconds  int     `yaml:"max_backoff_seconds"`
+}
+
+// StaticAnalysis enables the static analysis of the executables found by
+// the process scan. Files over MaxFileSizeMB are not analyzed.
+type StaticAnalysis struct {
+	Enabled       bool  `yaml:"enabled"`
+	MaxFileSizeMB int64 `yaml:"max_file_size_mb"`
+}
+
+// RiskConfig weights the factors of the per-process risk score. Without
+// Weights the default weights apply; once Weights is set, a factor left out
+// of it adds nothing. WritablePaths are globs of the temporary and
+// user-writable directories and default to DefaultWritablePaths.
+type RiskConfig struct {
+	Weights       *RiskWeights `yaml:"weights"`
+	WritablePaths []string     `yaml:"writable_paths"`
+}
+
+// RiskWeights are the points each factor adds to a risk score. Relationship
+// hits are scaled by rule severity and anomalies by their rarity. The
+// weights from Packed on are the static analysis traits of the executable.
+type RiskWeights struct {
+	Unsigned           int `yaml:"unsigned"`
+	MaliciousHash      int `yaml:"malicious_hash"`
+	PathIndicator      int `yaml:"path_indicator"`
+	Reputation         int `yaml:"reputation"`
+	Relationship       int `yaml:"relationship"`
+	WritableLocation   int `yaml:"writable_location"`
+	Masquerade         int `yaml:"masquerade"`
+	Image              int `yaml:"image"`
+	Module             int `yaml:"module"`
+	Anomaly            int `yaml:"anomaly"`
+	Listener           int `yaml:"listener"`
+	ExternalConnection int `yaml:"external_connection"`
+	Packed             int `yaml:"packed"`
+	HighEntropy        int `yaml:"high_entropy"`
+	WritableExecutable int `yaml:"writable_executable"`
+	EntryOutsideText   int `yaml:"entry_outside_text"`
+	Overlay            int `yaml:"overlay"`
+	NoImports          int `yaml:"no_imports"`
+	WritableRPath      int `yaml:"writable_rpath"`
+	UnusualInterpreter int `yaml:"unusual_interpreter"`
+	StaticInUserDir    int `yaml:"static_in_user_dir"`
+	Setuid             int `yaml:"setuid"`
+	FileCapabilities   int `yaml:"file_capabilities"`
+}
+
+// LearningConfig enables the learned baseline of parent-child pairs,
+// executable paths and users. It is trained for TrainingHours and kept at
+// Path across restarts.
+type LearningConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	TrainingHours int    `yaml:"training_hours"`
+	Path          string `yaml:"path"`
+}
+
+// ImageChecks enables the check for deleted, replaced and memory-only
+// executables on Linux. AnonymousMemory also reports writable and executable
+// anonymous mappings, which JIT compilers create routinely.
+type ImageChecks struct {
+	Enabled         bool `yaml:"enabled"`
+	AnonymousMemory bool `yaml:"anonymous_memory"`
+}
+
+// MasqueradeConfig enables the check for processes imitating the system
+// binaries listed in the Table file.
+type MasqueradeConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Table           string `yaml:"table"`
+	MaxEditDistance int    `yaml:"max_edit_distance"`
+}
+
+// MasqueradeTable lists the system binaries malware imitates. Allow holds
+// legitimate names close enough to a system binary to look like a typosquat;
+// KernelThreads holds the kernel thread name prefixes.
+type MasqueradeTable struct {
+	Binaries      []SystemBinary `yaml:"binaries"`
+	Allow         []string       `yaml:"allow"`
+	KernelThreads []string       `yaml:"kernel_threads"`
+}
+
+// SystemBinary is where a system binary lives and which processes start it.
+// Paths are globs as in the path feeds; no Parents means any parent.
+type SystemBinary struct {
+	Name    string   `yaml:"name" json:"name"`
+	Paths   []string `yaml:"paths" json:"paths"`
+	Parents []string `yaml:"parents" json:"parents,omitempty"`
+}
+
+// PersistenceScan configures the inventory of Linux autostart locations.
+// Entries missing from the baseline at BaselinePath are reported as added.
+type PersistenceScan struct {
+	Enabled      bool     `yaml:"enabled"`
+	BaselinePath string   `yaml:"baseline_path"`
+	Exclude      []string `yaml:"exclude"`
+}
+
+type ModuleScan struct {
+	Enabled bool     `yaml:"enabled"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// ProcessSourceConfig selects where the process list comes from. Snapshots
+// can be recorded to RecordPath and replayed later from ReplayPath.
+type ProcessSourceConfig struct {
+	Type       string `yaml:"type"`
+	ReplayPath string `yaml:"replay_path"`
+	RecordPath string `yaml:"record_path"`
+}
+
+type ProcessEvents struct {
+	Enabled            bool `yaml:"enabled"`
+	BufferSize         int  `yaml:"buffer_size"`
+	PollIntervalMillis int  `yaml:"poll_interval_ms"`
+	ExitGraceSeconds   int  `yaml:"exit_grace_seconds"`
+}
+
+type RealtimeConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	DebounceMillis int  `yaml:"debounce_ms"`
+}
+
+type FilesystemScan struct {
+	Workers       int      `yaml:"workers"`
+	MaxDepth      int      `yaml:"max_depth"`
+	MaxFileSizeMB int64    `yaml:"max_file_size_mb"`
+	Exclude       []string `yaml:"exclude"`
+}
+
+type ScheduleConfig struct {
+	Process     StageSchedule `yaml:"process"`
+	Filesystem  StageSchedule `yaml:"filesystem"`
+	Network     StageSchedule `yaml:"network"`
+	Persistence StageSchedule `yaml:"persistence"`
+}
+
+// StageSchedule sets when a scan stage runs. A cron expression takes
+// precedence over the interval; jitter adds a random delay to every run.
+type StageSchedule struct {
+	IntervalSeconds int    `yaml:"interval_seconds" json:"intervalSeconds"`
+	Cron            string `yaml:"cron" json:"cron,omitempty"`
+	JitterSeconds   int    `yaml:"jitter_seconds" json:"jitterSeconds"`
 }
 
 type ThreatIntelConfig struct {
-	Feeds []ThreatFeed `yaml:"feeds"`
+	Feeds                 []ThreatFeed      `yaml:"feeds"`
+	ReloadIntervalSeconds int               `yaml:"reload_interval_seconds"`
+	Reputation            *ReputationConfig `yaml:"reputation"`
+}
+
+type ReputationConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	URL               string `yaml:"url"`
+	APIKeyHeader      string `yaml:"api_key_header"`
+	APIKey            string `yaml:"api_key"`
+	BatchSize         int    `yaml:"batch_size"`
+	RequestsPerMinute int    `yaml:"requests_per_minute"`
+	CachePath         string `yaml:"cache_path"`
+	CacheTTLSeconds   int    `yaml:"cache_ttl_seconds"`
+	TimeoutSeconds    int    `yaml:"timeout_seconds"`
 }
 
 type ThreatFeed struct {
@@ -26,3 +227,33 @@ type MaliciousHash struct {
 	SHA256 string `json:"sha256"`
 	Type   string `json:"type"`
 }
+
+type PathIndicator struct {
+	Pattern string `json:"pattern"`
+	Match   string `json:"match"`
+	Type    string `json:"type"`
+}
+
+// RelationshipRule flags a child process started under a matching ancestor.
+// The parent matcher is tried against every ancestor up to Depth levels
+// above the child, so a depth of 2 also covers grandparents.
+type RelationshipRule struct {
+	ID          string         `yaml:"id" json:"id"`
+	Name        string         `yaml:"name" json:"name"`
+	Description string         `yaml:"description" json:"description,omitempty"`
+	Severity    string         `yaml:"severity" json:"severity"`
+	Tags        []string       `yaml:"tags" json:"tags,omitempty"`
+	Depth       int            `yaml:"depth" json:"depth"`
+	Parent      ProcessMatcher `yaml:"parent" json:"parent"`
+	Child       ProcessMatcher `yaml:"child" json:"child"`
+}
+
+// ProcessMatcher describes a process in a relationship rule. Every field set
+// must match; within a list any entry may match.
+type ProcessMatcher struct {
+	Name    []string `yaml:"name" json:"name,omitempty"`
+	Path    []string `yaml:"path" json:"path,omitempty"`
+	Cmdline string   `yaml:"cmdline" json:"cmdline,omitempty"`
+	Signer  []string `yaml:"signer" json:"signer,omitempty"`
+	Signed  *bool    `yaml:"signed" json:"signed,omitempty"`
+}